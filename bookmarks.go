@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/cretz/ffembedpoc/bookmarks"
+	"github.com/cretz/ffembedpoc/firefox"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+// Bookmarks bar, menu, and star button handling. Methods must be called on
+// the main thread.
+type bookmarksUI struct {
+	*browser
+	store  *bookmarks.Store
+	window *widgets.QMainWindow
+	bar    *widgets.QToolBar
+	menu   *widgets.QMenu
+}
+
+func newBookmarksUI(b *browser, store *bookmarks.Store, window *widgets.QMainWindow) *bookmarksUI {
+	u := &bookmarksUI{browser: b, store: store, window: window, bar: widgets.NewQToolBar2(nil)}
+	u.bar.SetToolButtonStyle(core.Qt__ToolButtonTextBesideIcon)
+	// The menu is rebuilt each time it's shown, the bar on change
+	u.menu = window.MenuBar().AddMenu2("&Bookmarks")
+	u.menu.ConnectAboutToShow(u.updateMenu)
+	store.ChangedListener.AddFunc(context.Background(), funcOnMain(u.onChanged))
+	u.updateBar()
+	return u
+}
+
+func (u *bookmarksUI) onChanged() {
+	u.updateBar()
+	// Stars may have changed
+	u.tabsLock.RLock()
+	defer u.tabsLock.RUnlock()
+	for _, tab := range u.tabs {
+		tab.toolbar.update()
+	}
+}
+
+func (u *bookmarksUI) updateBar() {
+	u.bar.Clear()
+	for _, b := range u.store.Get(bookmarks.RootToolbar).Children {
+		if b.Folder {
+			button := widgets.NewQToolButton(nil)
+			button.SetText(b.Title)
+			button.SetToolButtonStyle(core.Qt__ToolButtonTextOnly)
+			button.SetPopupMode(widgets.QToolButton__InstantPopup)
+			menu := widgets.NewQMenu(button)
+			u.addMenuItems(menu, b.Children)
+			button.SetMenu(menu)
+			u.bar.AddWidget(button)
+		} else {
+			url := b.URL
+			action := u.bar.AddAction2(u.faviconIcon(b.Favicon), b.Title)
+			action.ConnectTriggered(func(bool) { u.navigateCurrent(url) })
+		}
+	}
+}
+
+func (u *bookmarksUI) updateMenu() {
+	u.menu.Clear()
+	u.menu.AddAction("Bookmark/Unbookmark This Page").ConnectTriggered(func(bool) {
+		if tab := u.currentTab(); tab != nil {
+			u.toggle(tab.tab)
+		}
+	})
+	u.menu.AddAction("Import HTML...").ConnectTriggered(func(bool) { u.importHTML() })
+	u.menu.AddAction("Export HTML...").ConnectTriggered(func(bool) { u.exportHTML() })
+	u.menu.AddAction("Import from Firefox Profile").ConnectTriggered(func(bool) { u.importPlaces() })
+	u.menu.AddSeparator()
+	u.addMenuItems(u.menu, u.store.Get(bookmarks.RootMenu).Children)
+	u.menu.AddSeparator()
+	for _, id := range []string{bookmarks.RootToolbar, bookmarks.RootOther} {
+		folder := u.store.Get(id)
+		u.addMenuItems(u.menu.AddMenu2(folder.Title), folder.Children)
+	}
+}
+
+func (u *bookmarksUI) addMenuItems(menu *widgets.QMenu, items []*bookmarks.Bookmark) {
+	for _, b := range items {
+		if b.Folder {
+			u.addMenuItems(menu.AddMenu2(b.Title), b.Children)
+		} else {
+			url := b.URL
+			menu.AddAction2(u.faviconIcon(b.Favicon), b.Title).ConnectTriggered(func(bool) { u.navigateCurrent(url) })
+		}
+	}
+}
+
+func (u *bookmarksUI) navigateCurrent(url string) {
+	if tab := u.currentTab(); tab != nil {
+		tab.tab.NavigateTo(url)
+		go runOnMain(u.focus.focusPage)
+	}
+}
+
+// Whether the tab's URL is bookmarked
+func (u *bookmarksUI) bookmarked(tab *firefox.TabActor) bool {
+	return tab.URL() != "" && len(u.store.FindURL(tab.URL())) > 0
+}
+
+// Removes every bookmark for the tab's URL, or adds one to the toolbar if
+// there are none
+func (u *bookmarksUI) toggle(tab *firefox.TabActor) {
+	url := tab.URL()
+	if url == "" {
+		return
+	}
+	if existing := u.store.FindURL(url); len(existing) > 0 {
+		for _, b := range existing {
+			if err := u.store.Remove(b.ID); err != nil {
+				u.log.Errorf("Failed removing bookmark: %v", err)
+			}
+		}
+		return
+	}
+	b := &bookmarks.Bookmark{Title: tab.Title(), URL: url, Favicon: tab.Favicon()}
+	if _, err := u.store.Add(bookmarks.RootToolbar, -1, b); err != nil {
+		u.log.Errorf("Failed adding bookmark: %v", err)
+	}
+}
+
+func (u *bookmarksUI) importHTML() {
+	path := widgets.QFileDialog_GetOpenFileName(u.window, "Import Bookmarks", "", "HTML files (*.html *.htm)", "", 0)
+	if path == "" {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		u.log.Errorf("Failed opening bookmarks file: %v", err)
+		return
+	}
+	defer file.Close()
+	if byRoot, err := bookmarks.ParseHTML(file); err != nil {
+		u.log.Errorf("Failed parsing bookmarks file: %v", err)
+	} else if err = u.store.Import(byRoot); err != nil {
+		u.log.Errorf("Failed importing bookmarks: %v", err)
+	}
+}
+
+func (u *bookmarksUI) exportHTML() {
+	path := widgets.QFileDialog_GetSaveFileName(u.window, "Export Bookmarks", "bookmarks.html", "HTML files (*.html *.htm)", "", 0)
+	if path == "" {
+		return
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		u.log.Errorf("Failed creating bookmarks file: %v", err)
+		return
+	}
+	err = u.store.ExportHTML(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		u.log.Errorf("Failed exporting bookmarks: %v", err)
+	}
+}
+
+// Runs in the background since the databases may be large
+func (u *bookmarksUI) importPlaces() {
+	go func() {
+		if byRoot, err := bookmarks.ReadPlaces(profilePath); err != nil {
+			u.log.Errorf("Failed reading Firefox bookmarks: %v", err)
+		} else if err = u.store.Import(byRoot); err != nil {
+			u.log.Errorf("Failed importing bookmarks: %v", err)
+		}
+	}()
+}
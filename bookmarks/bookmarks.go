@@ -0,0 +1,363 @@
+// Package bookmarks stores bookmarks in folders and imports/exports them
+package bookmarks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cretz/ffembedpoc/firefox"
+)
+
+// IDs of the root folders which always exist and can't be changed
+const (
+	RootToolbar = "toolbar"
+	RootMenu    = "menu"
+	RootOther   = "other"
+)
+
+var rootTitles = map[string]string{
+	RootToolbar: "Bookmarks Toolbar",
+	RootMenu:    "Bookmarks Menu",
+	RootOther:   "Other Bookmarks",
+}
+
+// Bookmark is a bookmark or a folder of them
+type Bookmark struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Folder bool   `json:"folder,omitempty"`
+	// Empty for folders
+	URL  string   `json:"url,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	// Image data, usually PNG
+	Favicon  []byte    `json:"favicon,omitempty"`
+	Added    time.Time `json:"added"`
+	Modified time.Time `json:"modified"`
+	// Only for folders, in order
+	Children []*Bookmark `json:"children,omitempty"`
+}
+
+func (b *Bookmark) copy() *Bookmark {
+	c := *b
+	c.Tags = append([]string(nil), b.Tags...)
+	c.Children = make([]*Bookmark, len(b.Children))
+	for i, child := range b.Children {
+		c.Children[i] = child.copy()
+	}
+	return &c
+}
+
+// Store is a tree of bookmarks saved as JSON to a file on every change. It is
+// safe for concurrent use.
+type Store struct {
+	ChangedListener firefox.EventListener
+
+	path string
+	// Governs fields below it
+	lock  sync.RWMutex
+	roots []*Bookmark
+	byID  map[string]*Bookmark
+	// Keyed by child ID
+	parents map[string]*Bookmark
+}
+
+// Open loads the store at the given file path, or starts an empty one if it
+// doesn't exist
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		for _, id := range []string{RootToolbar, RootMenu, RootOther} {
+			now := time.Now()
+			s.roots = append(s.roots, &Bookmark{ID: id, Title: rootTitles[id], Folder: true, Added: now, Modified: now})
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed reading bookmarks: %w", err)
+	} else if err = json.Unmarshal(b, &s.roots); err != nil {
+		return nil, fmt.Errorf("invalid bookmarks file: %w", err)
+	}
+	s.reindexUnlocked()
+	for id := range rootTitles {
+		if s.byID[id] == nil {
+			return nil, fmt.Errorf("bookmarks file missing root %v", id)
+		}
+	}
+	return s, nil
+}
+
+func (s *Store) reindexUnlocked() {
+	s.byID, s.parents = map[string]*Bookmark{}, map[string]*Bookmark{}
+	var index func(parent *Bookmark, b *Bookmark)
+	index = func(parent *Bookmark, b *Bookmark) {
+		s.byID[b.ID] = b
+		if parent != nil {
+			s.parents[b.ID] = parent
+		}
+		for _, child := range b.Children {
+			index(b, child)
+		}
+	}
+	for _, root := range s.roots {
+		index(nil, root)
+	}
+}
+
+// Written to a temp file then renamed so a crash doesn't lose everything
+func (s *Store) saveUnlocked() error {
+	b, err := json.MarshalIndent(s.roots, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed creating temp file: %w", err)
+	}
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed saving bookmarks: %w", err)
+	}
+	return nil
+}
+
+// Runs fn under the write lock, saving and notifying if it succeeds. The
+// index is rebuilt after since fn may restructure the tree.
+func (s *Store) update(fn func() error) error {
+	s.lock.Lock()
+	err := fn()
+	if err == nil {
+		s.reindexUnlocked()
+		err = s.saveUnlocked()
+	}
+	s.lock.Unlock()
+	if err == nil {
+		s.ChangedListener.Fire()
+	}
+	return err
+}
+
+// Get returns a copy of the bookmark or folder (with its descendants), or nil
+// if not found
+func (s *Store) Get(id string) *Bookmark {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if b := s.byID[id]; b != nil {
+		return b.copy()
+	}
+	return nil
+}
+
+// Add adds a copy of the bookmark (and any children) to the folder at the
+// index, or at the end if the index is negative or past the end. IDs are
+// assigned and missing times set. The new ID is returned.
+func (s *Store) Add(folderID string, index int, b *Bookmark) (id string, err error) {
+	err = s.update(func() error {
+		folder := s.byID[folderID]
+		if folder == nil || !folder.Folder {
+			return fmt.Errorf("folder %v not found", folderID)
+		}
+		b = b.copy()
+		prepareNew(b, time.Now())
+		id = b.ID
+		folder.Children = insert(folder.Children, index, b)
+		folder.Modified = time.Now()
+		return nil
+	})
+	return
+}
+
+// Import adds copies of the bookmarks to the end of the root folders they are
+// keyed by
+func (s *Store) Import(byRoot map[string][]*Bookmark) error {
+	return s.update(func() error {
+		now := time.Now()
+		for rootID, bookmarks := range byRoot {
+			root := s.byID[rootID]
+			if root == nil || rootTitles[rootID] == "" {
+				return fmt.Errorf("unknown root %v", rootID)
+			}
+			for _, b := range bookmarks {
+				b = b.copy()
+				prepareNew(b, now)
+				root.Children = append(root.Children, b)
+			}
+			root.Modified = now
+		}
+		return nil
+	})
+}
+
+func prepareNew(b *Bookmark, now time.Time) {
+	b.ID = newID()
+	if b.Added.IsZero() {
+		b.Added = now
+	}
+	if b.Modified.IsZero() {
+		b.Modified = b.Added
+	}
+	if !b.Folder {
+		b.Children = nil
+	}
+	for _, child := range b.Children {
+		prepareNew(child, now)
+	}
+}
+
+// Update sets the title, URL, tags, and favicon of the existing bookmark with
+// the same ID. Only the title is used for folders.
+func (s *Store) Update(b *Bookmark) error {
+	return s.update(func() error {
+		existing := s.byID[b.ID]
+		if existing == nil {
+			return fmt.Errorf("bookmark %v not found", b.ID)
+		} else if rootTitles[b.ID] != "" {
+			return fmt.Errorf("cannot update root %v", b.ID)
+		}
+		existing.Title = b.Title
+		if !existing.Folder {
+			existing.URL = b.URL
+			existing.Tags = append([]string(nil), b.Tags...)
+			existing.Favicon = b.Favicon
+		}
+		existing.Modified = time.Now()
+		return nil
+	})
+}
+
+// Move moves the bookmark or folder to the index in the folder. See Add for
+// the index.
+func (s *Store) Move(id string, folderID string, index int) error {
+	return s.update(func() error {
+		b, folder := s.byID[id], s.byID[folderID]
+		if b == nil {
+			return fmt.Errorf("bookmark %v not found", id)
+		} else if rootTitles[id] != "" {
+			return fmt.Errorf("cannot move root %v", id)
+		} else if folder == nil || !folder.Folder {
+			return fmt.Errorf("folder %v not found", folderID)
+		}
+		// Can't move into itself
+		for f := folder; f != nil; f = s.parents[f.ID] {
+			if f == b {
+				return fmt.Errorf("cannot move folder into itself")
+			}
+		}
+		parent := s.parents[id]
+		parent.Children = remove(parent.Children, b)
+		folder.Children = insert(folder.Children, index, b)
+		parent.Modified, folder.Modified = time.Now(), time.Now()
+		return nil
+	})
+}
+
+// Remove removes the bookmark or folder with its descendants
+func (s *Store) Remove(id string) error {
+	return s.update(func() error {
+		b := s.byID[id]
+		if b == nil {
+			return fmt.Errorf("bookmark %v not found", id)
+		} else if rootTitles[id] != "" {
+			return fmt.Errorf("cannot remove root %v", id)
+		}
+		parent := s.parents[id]
+		parent.Children = remove(parent.Children, b)
+		parent.Modified = time.Now()
+		return nil
+	})
+}
+
+// FindURL returns copies of every bookmark for the URL
+func (s *Store) FindURL(url string) []*Bookmark {
+	return s.find(func(b *Bookmark) bool { return !b.Folder && b.URL == url })
+}
+
+// Tagged returns copies of every bookmark with the tag
+func (s *Store) Tagged(tag string) []*Bookmark {
+	return s.find(func(b *Bookmark) bool {
+		for _, t := range b.Tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Tags returns every tag in use, sorted
+func (s *Store) Tags() []string {
+	s.lock.RLock()
+	seen := map[string]bool{}
+	for _, b := range s.byID {
+		for _, tag := range b.Tags {
+			seen[tag] = true
+		}
+	}
+	s.lock.RUnlock()
+	tags := make([]string, 0, len(seen))
+	for tag := range seen {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// In tree order
+func (s *Store) find(include func(*Bookmark) bool) []*Bookmark {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var found []*Bookmark
+	var walk func(b *Bookmark)
+	walk = func(b *Bookmark) {
+		if include(b) {
+			found = append(found, b.copy())
+		}
+		for _, child := range b.Children {
+			walk(child)
+		}
+	}
+	for _, root := range s.roots {
+		walk(root)
+	}
+	return found
+}
+
+func insert(children []*Bookmark, index int, b *Bookmark) []*Bookmark {
+	if index < 0 || index > len(children) {
+		index = len(children)
+	}
+	children = append(children, nil)
+	copy(children[index+1:], children[index:])
+	children[index] = b
+	return children
+}
+
+func remove(children []*Bookmark, b *Bookmark) []*Bookmark {
+	for i, child := range children {
+		if child == b {
+			return append(children[:i], children[i+1:]...)
+		}
+	}
+	return children
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,191 @@
+package bookmarks
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The Netscape bookmark file format is loose HTML shared by most browsers. A
+// folder is an H3 followed by a DL of its items, each item is a DT with an A.
+
+var (
+	netscapeTag  = regexp.MustCompile(`(?is)<(/?)([a-z0-9]+)([^>]*)>`)
+	netscapeAttr = regexp.MustCompile(`(?is)([a-z_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// ParseHTML reads a Netscape bookmark file. Items are keyed by the root they
+// belong in: the toolbar and unfiled (i.e. other) folders are recognized as
+// they are exported by Firefox, everything else is in the menu.
+func ParseHTML(r io.Reader) (map[string][]*Bookmark, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	doc := string(b)
+	byRoot := map[string][]*Bookmark{}
+	// The top of the stack is the folder being filled, nil for the top level
+	var stack []*Bookmark
+	var pendingFolder *Bookmark
+	var pendingRoot string
+	// Set while reading an element's text
+	var textStart int
+	var textOf *Bookmark
+	add := func(b *Bookmark) {
+		if len(stack) > 0 && stack[len(stack)-1] != nil {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, b)
+		} else {
+			byRoot[RootMenu] = append(byRoot[RootMenu], b)
+		}
+	}
+	// A folder header without a DL after it is an empty folder
+	addPendingFolder := func() {
+		if pendingFolder != nil && pendingRoot == "" {
+			add(pendingFolder)
+		}
+		pendingFolder = nil
+	}
+	for _, loc := range netscapeTag.FindAllStringSubmatchIndex(doc, -1) {
+		closing := loc[3] > loc[2]
+		name := strings.ToUpper(doc[loc[4]:loc[5]])
+		attrs := parseAttrs(doc[loc[6]:loc[7]])
+		switch {
+		case !closing && (name == "H3" || name == "A"):
+			addPendingFolder()
+			b := &Bookmark{Folder: name == "H3", Added: unixAttr(attrs["ADD_DATE"])}
+			b.Modified = unixAttr(attrs["LAST_MODIFIED"])
+			if b.Folder {
+				pendingFolder, pendingRoot = b, ""
+				if attrs["PERSONAL_TOOLBAR_FOLDER"] == "true" {
+					pendingRoot = RootToolbar
+				} else if attrs["UNFILED_BOOKMARKS_FOLDER"] == "true" {
+					pendingRoot = RootOther
+				}
+			} else {
+				b.URL = attrs["HREF"]
+				if tags := attrs["TAGS"]; tags != "" {
+					b.Tags = strings.Split(tags, ",")
+				}
+				b.Favicon = decodeDataURL(attrs["ICON"])
+				add(b)
+			}
+			textStart, textOf = loc[1], b
+		case closing && (name == "H3" || name == "A"):
+			if textOf != nil {
+				textOf.Title = strings.TrimSpace(html.UnescapeString(doc[textStart:loc[0]]))
+				textOf = nil
+			}
+		case !closing && name == "DL":
+			// A DL after a folder header is its contents. The toolbar and unfiled
+			// folders' contents go directly in those roots.
+			switch {
+			case pendingFolder != nil && pendingRoot != "":
+				stack = append(stack, &Bookmark{ID: pendingRoot, Folder: true})
+			case pendingFolder != nil:
+				add(pendingFolder)
+				stack = append(stack, pendingFolder)
+			default:
+				stack = append(stack, nil)
+			}
+			pendingFolder = nil
+		case closing && name == "DL":
+			addPendingFolder()
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected </DL>")
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if top != nil && rootTitles[top.ID] != "" {
+				byRoot[top.ID] = append(byRoot[top.ID], top.Children...)
+			}
+		}
+	}
+	return byRoot, nil
+}
+
+func parseAttrs(s string) map[string]string {
+	attrs := map[string]string{}
+	for _, m := range netscapeAttr.FindAllStringSubmatch(s, -1) {
+		attrs[strings.ToUpper(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+	}
+	return attrs
+}
+
+func unixAttr(s string) time.Time {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil && secs > 0 {
+		return time.Unix(secs, 0)
+	}
+	return time.Time{}
+}
+
+// Nil if not a base64 data URL
+func decodeDataURL(s string) []byte {
+	i := strings.Index(s, ";base64,")
+	if !strings.HasPrefix(s, "data:") || i < 0 {
+		return nil
+	}
+	b, _ := base64.StdEncoding.DecodeString(s[i+len(";base64,"):])
+	return b
+}
+
+// ExportHTML writes every bookmark as a Netscape bookmark file the way
+// Firefox does: the menu at the top level with the toolbar and other folders
+// in it
+func (s *Store) ExportHTML(w io.Writer) error {
+	menu, toolbar, other := s.Get(RootMenu), s.Get(RootToolbar), s.Get(RootOther)
+	bw := bufio.NewWriter(w)
+	bw.WriteString("<!DOCTYPE NETSCAPE-Bookmark-file-1>\n" +
+		"<!-- This is an automatically generated file.\n" +
+		"     It will be read and overwritten.\n" +
+		"     DO NOT EDIT! -->\n" +
+		`<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">` + "\n" +
+		"<TITLE>Bookmarks</TITLE>\n" +
+		"<H1>Bookmarks Menu</H1>\n\n" +
+		"<DL><p>\n")
+	for _, child := range menu.Children {
+		writeHTML(bw, child, 1, "")
+	}
+	writeHTML(bw, toolbar, 1, ` PERSONAL_TOOLBAR_FOLDER="true"`)
+	writeHTML(bw, other, 1, ` UNFILED_BOOKMARKS_FOLDER="true"`)
+	bw.WriteString("</DL>\n")
+	return bw.Flush()
+}
+
+func writeHTML(w *bufio.Writer, b *Bookmark, depth int, extraAttrs string) {
+	indent := strings.Repeat("    ", depth)
+	dates := fmt.Sprintf(` ADD_DATE="%d" LAST_MODIFIED="%d"`, unixSecs(b.Added), unixSecs(b.Modified))
+	if b.Folder {
+		fmt.Fprintf(w, "%v<DT><H3%v%v>%v</H3>\n", indent, dates, extraAttrs, html.EscapeString(b.Title))
+		fmt.Fprintf(w, "%v<DL><p>\n", indent)
+		for _, child := range b.Children {
+			writeHTML(w, child, depth+1, "")
+		}
+		fmt.Fprintf(w, "%v</DL><p>\n", indent)
+		return
+	}
+	attrs := fmt.Sprintf(` HREF="%v"`, html.EscapeString(b.URL)) + dates
+	if len(b.Favicon) > 0 {
+		attrs += fmt.Sprintf(` ICON="data:%v;base64,%v"`,
+			http.DetectContentType(b.Favicon), base64.StdEncoding.EncodeToString(b.Favicon))
+	}
+	if len(b.Tags) > 0 {
+		attrs += fmt.Sprintf(` TAGS="%v"`, html.EscapeString(strings.Join(b.Tags, ",")))
+	}
+	fmt.Fprintf(w, "%v<DT><A%v>%v</A>\n", indent, attrs, html.EscapeString(b.Title))
+}
+
+func unixSecs(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,121 @@
+package bookmarks
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A 1x1 PNG
+var testFavicon = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89")
+
+func TestHTMLRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bookmarks-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := Open(filepath.Join(dir, "bookmarks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(secs int64) time.Time { return time.Unix(1600000000+secs, 0) }
+	expected := map[string][]*Bookmark{
+		RootToolbar: {
+			{Title: "Example", URL: "https://example.com/?a=1&b=2", Tags: []string{"news", "dev"},
+				Favicon: testFavicon, Added: at(1), Modified: at(2)},
+			{Title: "Dev <& \"Tools\">", Folder: true, Added: at(3), Modified: at(4), Children: []*Bookmark{
+				{Title: "Go", URL: "https://go.dev/", Added: at(5), Modified: at(5)},
+				{Title: "Empty", Folder: true, Added: at(6), Modified: at(6)},
+				{Title: "Nested", Folder: true, Added: at(7), Modified: at(8), Children: []*Bookmark{
+					{Title: "Mozilla", URL: "https://www.mozilla.org/", Added: at(9), Modified: at(9)},
+				}},
+			}},
+		},
+		RootMenu: {
+			{Title: "Docs", URL: "https://example.com/docs", Added: at(10), Modified: at(11)},
+			{Title: "Menu Folder", Folder: true, Added: at(12), Modified: at(12), Children: []*Bookmark{
+				{Title: "Quote's", URL: "https://example.com/it's", Added: at(13), Modified: at(13)},
+			}},
+		},
+		RootOther: {
+			{Title: "Unfiled", URL: "https://unfiled.example/", Added: at(14), Modified: at(14)},
+		},
+	}
+	if err := s.Import(expected); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := s.ExportHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	byRoot, err := ParseHTML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for root, bookmarks := range expected {
+		if !reflect.DeepEqual(byRoot[root], bookmarks) {
+			t.Errorf("root %v: expected %v, got %v", root, describe(bookmarks), describe(byRoot[root]))
+		}
+	}
+	if len(byRoot) != len(expected) {
+		t.Errorf("expected %v roots, got %v", len(expected), len(byRoot))
+	}
+}
+
+func TestParseHTML(t *testing.T) {
+	// As exported by other browsers, loosely formatted
+	const doc = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1600000001" LAST_MODIFIED="1600000002" PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+    <DL><p>
+        <dt><a href='https://example.com/' add_date=1600000003 tags="a,b">  Example &amp; Co  </a>
+        <DT><H3 ADD_DATE="1600000004">No Contents</H3>
+        <DT><H3 ADD_DATE="1600000005">Folder</H3>
+        <DL><p>
+            <DT><A HREF="https://go.dev/" ICON="data:image/png;base64,aGk=">Go</A>
+        </DL><p>
+    </DL><p>
+    <DT><A HREF="https://top.example/" ADD_DATE="0">Top</A>
+    <DT><H3 UNFILED_BOOKMARKS_FOLDER="true">Other bookmarks</H3>
+    <DL><p>
+        <DT><A HREF="https://other.example/">Other</A>
+    </DL><p>
+</DL><p>
+`
+	byRoot, err := ParseHTML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(secs int64) time.Time { return time.Unix(1600000000+secs, 0) }
+	expected := map[string][]*Bookmark{
+		RootToolbar: {
+			{Title: "Example & Co", URL: "https://example.com/", Tags: []string{"a", "b"}, Added: at(3)},
+			{Title: "No Contents", Folder: true, Added: at(4)},
+			{Title: "Folder", Folder: true, Added: at(5), Children: []*Bookmark{
+				{Title: "Go", URL: "https://go.dev/", Favicon: []byte("hi")},
+			}},
+		},
+		RootMenu:  {{Title: "Top", URL: "https://top.example/"}},
+		RootOther: {{Title: "Other", URL: "https://other.example/"}},
+	}
+	for root, bookmarks := range expected {
+		if !reflect.DeepEqual(byRoot[root], bookmarks) {
+			t.Errorf("root %v: expected %v, got %v", root, describe(bookmarks), describe(byRoot[root]))
+		}
+	}
+	if len(byRoot) != len(expected) {
+		t.Errorf("expected %v roots, got %v", len(expected), len(byRoot))
+	}
+	if _, err := ParseHTML(strings.NewReader("<DL><p></DL></DL>")); err == nil {
+		t.Fatal("expected error for unbalanced list")
+	}
+}
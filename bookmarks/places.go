@@ -0,0 +1,243 @@
+package bookmarks
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cretz/ffembedpoc/sqlite"
+)
+
+// moz_bookmarks types, separators are skipped
+const (
+	placesTypeBookmark = 1
+	placesTypeFolder   = 2
+)
+
+// moz_bookmarks GUIDs of the roots, in the order they're imported
+var placesRoots = []struct{ guid, root string }{
+	{"toolbar_____", RootToolbar},
+	{"menu________", RootMenu},
+	{"unfiled_____", RootOther},
+	{"mobile______", RootOther},
+}
+
+// Folders under it are tags, with the tagged URLs as children
+const placesTagsGUID = "tags________"
+
+// Favicons of this size or the next larger one are preferred
+const placesFaviconWidth = 16
+
+type placesItem struct {
+	id       int64
+	typ      int64
+	placeID  int64
+	parent   int64
+	position int64
+	title    string
+	guid     string
+	added    int64
+	modified int64
+}
+
+// ReadPlaces reads the bookmarks in the places.sqlite database of the Firefox
+// profile at the path, keyed by root like ParseHTML. Favicons come from the
+// profile's favicons.sqlite if it's there. The databases are only read into
+// memory, never opened with SQLite, so Firefox can be running.
+func ReadPlaces(profilePath string) (map[string][]*Bookmark, error) {
+	db, err := sqlite.Open(filepath.Join(profilePath, "places.sqlite"))
+	if err != nil {
+		return nil, fmt.Errorf("failed opening places: %w", err)
+	}
+	byGUID := map[string]*placesItem{}
+	children := map[int64][]*placesItem{}
+	err = db.Scan("moz_bookmarks", func(row *sqlite.Row) error {
+		item := &placesItem{
+			id:       row.Int("id"),
+			typ:      row.Int("type"),
+			placeID:  row.Int("fk"),
+			parent:   row.Int("parent"),
+			position: row.Int("position"),
+			title:    row.Text("title"),
+			guid:     row.Text("guid"),
+			added:    row.Int("dateAdded"),
+			modified: row.Int("lastModified"),
+		}
+		byGUID[item.guid] = item
+		children[item.parent] = append(children[item.parent], item)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading places bookmarks: %w", err)
+	}
+	for _, c := range children {
+		sort.SliceStable(c, func(i, j int) bool { return c[i].position < c[j].position })
+	}
+	urls := map[int64]string{}
+	err = db.Scan("moz_places", func(row *sqlite.Row) error {
+		urls[row.Int("id")] = row.Text("url")
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading places URLs: %w", err)
+	}
+	// Tags are folders in the tags root holding an entry per tagged URL
+	tags := map[int64][]string{}
+	if tagsRoot := byGUID[placesTagsGUID]; tagsRoot != nil {
+		for _, tag := range children[tagsRoot.id] {
+			for _, tagged := range children[tag.id] {
+				tags[tagged.placeID] = append(tags[tagged.placeID], tag.title)
+			}
+		}
+	}
+	favicons, err := readPlacesFavicons(filepath.Join(profilePath, "favicons.sqlite"))
+	if err != nil {
+		return nil, err
+	}
+	// Build each root's tree
+	var toBookmark func(item *placesItem) *Bookmark
+	toBookmark = func(item *placesItem) *Bookmark {
+		b := &Bookmark{Title: item.title, Added: microsTime(item.added), Modified: microsTime(item.modified)}
+		switch item.typ {
+		case placesTypeFolder:
+			b.Folder = true
+			for _, child := range children[item.id] {
+				if c := toBookmark(child); c != nil {
+					b.Children = append(b.Children, c)
+				}
+			}
+		case placesTypeBookmark:
+			b.URL = urls[item.placeID]
+			// Queries only work in Firefox
+			if b.URL == "" || strings.HasPrefix(b.URL, "place:") {
+				return nil
+			}
+			b.Tags = tags[item.placeID]
+			b.Favicon = favicons.forPage(b.URL)
+		default:
+			return nil
+		}
+		return b
+	}
+	byRoot := map[string][]*Bookmark{}
+	for _, root := range placesRoots {
+		item := byGUID[root.guid]
+		if item == nil {
+			continue
+		}
+		for _, child := range children[item.id] {
+			if b := toBookmark(child); b != nil {
+				byRoot[root.root] = append(byRoot[root.root], b)
+			}
+		}
+	}
+	return byRoot, nil
+}
+
+type placesIcon struct {
+	width int64
+	data  []byte
+}
+
+type placesFavicons struct {
+	byPage map[string]*placesIcon
+	// Icons for every page of the origin, e.g. /favicon.ico
+	byOrigin map[string]*placesIcon
+}
+
+// Empty if the file doesn't exist
+func readPlacesFavicons(path string) (*placesFavicons, error) {
+	f := &placesFavicons{byPage: map[string]*placesIcon{}, byOrigin: map[string]*placesIcon{}}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return f, nil
+	}
+	db, err := sqlite.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening favicons: %w", err)
+	}
+	icons := map[int64]*placesIcon{}
+	err = db.Scan("moz_icons", func(row *sqlite.Row) error {
+		icon := &placesIcon{width: row.Int("width"), data: row.Blob("data")}
+		if len(icon.data) == 0 {
+			return nil
+		}
+		icons[row.Int("id")] = icon
+		if row.Int("root") != 0 {
+			if origin := urlOrigin(row.Text("icon_url")); origin != "" {
+				f.byOrigin[origin] = preferredIcon(f.byOrigin[origin], icon)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading favicons: %w", err)
+	}
+	pages := map[int64]string{}
+	err = db.Scan("moz_pages_w_icons", func(row *sqlite.Row) error {
+		pages[row.Int("id")] = row.Text("page_url")
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading favicon pages: %w", err)
+	}
+	err = db.Scan("moz_icons_to_pages", func(row *sqlite.Row) error {
+		page, icon := pages[row.Int("page_id")], icons[row.Int("icon_id")]
+		if page != "" && icon != nil {
+			f.byPage[page] = preferredIcon(f.byPage[page], icon)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading favicon page links: %w", err)
+	}
+	return f, nil
+}
+
+// Nil if there's none
+func (f *placesFavicons) forPage(pageURL string) []byte {
+	icon := f.byPage[pageURL]
+	if icon == nil {
+		icon = f.byOrigin[urlOrigin(pageURL)]
+	}
+	if icon == nil {
+		return nil
+	}
+	return icon.data
+}
+
+// The smallest icon at least placesFaviconWidth wide, otherwise the largest
+func preferredIcon(a, b *placesIcon) *placesIcon {
+	if a == nil {
+		return b
+	}
+	aFits, bFits := a.width >= placesFaviconWidth, b.width >= placesFaviconWidth
+	switch {
+	case aFits != bFits:
+		if aFits {
+			return a
+		}
+	case aFits && a.width <= b.width, !aFits && a.width >= b.width:
+		return a
+	}
+	return b
+}
+
+// Empty for URLs without a host
+func urlOrigin(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+func microsTime(micros int64) time.Time {
+	if micros == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, micros*int64(time.Microsecond))
+}
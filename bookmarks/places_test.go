@@ -0,0 +1,69 @@
+package bookmarks
+
+import (
+	"reflect"
+	"testing"
+)
+
+// See testdata/profile/places.sql for how the databases were made
+
+func TestReadPlaces(t *testing.T) {
+	byRoot, err := ReadPlaces("testdata/profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookmark := func(title, url string, added, modified int64, favicon string, tags ...string) *Bookmark {
+		b := &Bookmark{Title: title, URL: url, Tags: tags, Added: microsTime(added), Modified: microsTime(modified)}
+		if favicon != "" {
+			b.Favicon = []byte(favicon)
+		}
+		return b
+	}
+	expected := map[string][]*Bookmark{
+		RootToolbar: {
+			bookmark("Example", "https://example.com/", 1600000003000000, 1600000004000000, "example 16", "news", "dev"),
+			{
+				Title:    "Dev",
+				Folder:   true,
+				Added:    microsTime(1600000001000000),
+				Modified: microsTime(1600000002000000),
+				Children: []*Bookmark{
+					bookmark("Mozilla", "https://www.mozilla.org/", 1600000006000000, 1600000006000000, ""),
+					bookmark("Go", "https://go.dev/", 1600000005000000, 1600000005000000, "go root 16", "dev"),
+				},
+			},
+		},
+		RootMenu: {
+			bookmark("Docs", "https://example.com/docs", 1600000009000000, 1600000009000000, "docs 12"),
+		},
+		RootOther: {
+			bookmark("Unfiled", "https://unfiled.example/", 1600000010000000, 1600000010000000, ""),
+			bookmark("Mobile", "https://mobile.example/", 1600000011000000, 1600000011000000, ""),
+		},
+	}
+	for root, bookmarks := range expected {
+		if !reflect.DeepEqual(byRoot[root], bookmarks) {
+			t.Errorf("root %v: expected %v, got %v", root, describe(bookmarks), describe(byRoot[root]))
+		}
+	}
+	if len(byRoot) != len(expected) {
+		t.Errorf("expected %v roots, got %v", len(expected), len(byRoot))
+	}
+}
+
+func TestReadPlacesMissing(t *testing.T) {
+	if _, err := ReadPlaces("testdata/missing"); err == nil {
+		t.Fatal("expected error for missing profile")
+	}
+}
+
+func describe(bookmarks []*Bookmark) []string {
+	var desc []string
+	for _, b := range bookmarks {
+		desc = append(desc, b.Title+" "+b.URL+" "+string(b.Favicon))
+		for _, child := range describe(b.Children) {
+			desc = append(desc, "  "+child)
+		}
+	}
+	return desc
+}
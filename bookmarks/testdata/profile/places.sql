@@ -0,0 +1,59 @@
+-- Generates places.sqlite and favicons.sqlite with the tables Firefox uses,
+-- run from this dir with:
+--   rm -f *.sqlite; sqlite3 places.sqlite < places.sql
+CREATE TABLE moz_places (id INTEGER PRIMARY KEY, url LONGVARCHAR, title LONGVARCHAR, rev_host LONGVARCHAR, visit_count INTEGER DEFAULT 0, hidden INTEGER DEFAULT 0 NOT NULL, typed INTEGER DEFAULT 0 NOT NULL, frecency INTEGER DEFAULT -1 NOT NULL, last_visit_date INTEGER , guid TEXT, foreign_count INTEGER DEFAULT 0 NOT NULL, url_hash INTEGER DEFAULT 0 NOT NULL , description TEXT, preview_image_url TEXT, site_name TEXT, origin_id INTEGER, recalc_frecency INTEGER NOT NULL DEFAULT 0, alt_frecency INTEGER, recalc_alt_frecency INTEGER NOT NULL DEFAULT 0);
+CREATE TABLE moz_bookmarks (id INTEGER PRIMARY KEY, type INTEGER, fk INTEGER DEFAULT NULL, parent INTEGER, position INTEGER, title LONGVARCHAR, keyword_id INTEGER, folder_type TEXT, dateAdded INTEGER, lastModified INTEGER, guid TEXT, syncStatus INTEGER NOT NULL DEFAULT 0, syncChangeCounter INTEGER NOT NULL DEFAULT 1);
+
+INSERT INTO moz_places (id, url, title, guid) VALUES
+  (1, 'https://example.com/', 'Example', 'place1______'),
+  (2, 'https://go.dev/', 'Go', 'place2______'),
+  (3, 'https://www.mozilla.org/', 'Mozilla', 'place3______'),
+  (4, 'https://example.com/docs', 'Docs', 'place4______'),
+  (5, 'https://unfiled.example/', 'Unfiled', 'place5______'),
+  (6, 'https://mobile.example/', 'Mobile', 'place6______'),
+  (7, 'place:sort=8&maxResults=10', 'Recent', 'place7______'),
+  (8, 'https://unbookmarked.example/', 'Unbookmarked', 'place8______');
+
+INSERT INTO moz_bookmarks (id, type, fk, parent, position, title, dateAdded, lastModified, guid) VALUES
+  (1, 2, NULL, 0, 0, '', 1600000000000000, 1600000000000000, 'root________'),
+  (2, 2, NULL, 1, 0, 'menu', 1600000000000000, 1600000000000000, 'menu________'),
+  (3, 2, NULL, 1, 1, 'toolbar', 1600000000000000, 1600000000000000, 'toolbar_____'),
+  (4, 2, NULL, 1, 2, 'tags', 1600000000000000, 1600000000000000, 'tags________'),
+  (5, 2, NULL, 1, 3, 'unfiled', 1600000000000000, 1600000000000000, 'unfiled_____'),
+  (6, 2, NULL, 1, 4, 'mobile', 1600000000000000, 1600000000000000, 'mobile______'),
+  -- Toolbar, out of position order
+  (10, 2, NULL, 3, 1, 'Dev', 1600000001000000, 1600000002000000, 'folderDev___'),
+  (11, 1, 1, 3, 0, 'Example', 1600000003000000, 1600000004000000, 'bmExample___'),
+  (12, 1, 2, 10, 1, 'Go', 1600000005000000, 1600000005000000, 'bmGo________'),
+  (13, 1, 3, 10, 0, 'Mozilla', 1600000006000000, 1600000006000000, 'bmMozilla___'),
+  (14, 3, NULL, 10, 2, NULL, 1600000007000000, 1600000007000000, 'separator___'),
+  -- Menu
+  (20, 1, 7, 2, 0, 'Recent', 1600000008000000, 1600000008000000, 'bmRecent____'),
+  (21, 1, 4, 2, 1, 'Docs', 1600000009000000, 1600000009000000, 'bmDocs______'),
+  -- Other
+  (30, 1, 5, 5, 0, 'Unfiled', 1600000010000000, 1600000010000000, 'bmUnfiled___'),
+  (31, 1, 6, 6, 0, 'Mobile', 1600000011000000, 1600000011000000, 'bmMobile____'),
+  -- Tags
+  (40, 2, NULL, 4, 0, 'news', 1600000012000000, 1600000012000000, 'tagNews_____'),
+  (41, 1, 1, 40, 0, NULL, 1600000012000000, 1600000012000000, 'tagged1_____'),
+  (42, 2, NULL, 4, 1, 'dev', 1600000013000000, 1600000013000000, 'tagDev______'),
+  (43, 1, 2, 42, 0, NULL, 1600000013000000, 1600000013000000, 'tagged2_____'),
+  (44, 1, 1, 42, 1, NULL, 1600000013000000, 1600000013000000, 'tagged3_____');
+
+ATTACH 'favicons.sqlite' AS favicons;
+CREATE TABLE favicons.moz_icons ( id INTEGER PRIMARY KEY, icon_url TEXT NOT NULL, fixed_icon_url_hash INTEGER NOT NULL, width INTEGER NOT NULL DEFAULT 0, root INTEGER NOT NULL DEFAULT 0, color INTEGER, expire_ms INTEGER NOT NULL DEFAULT 0, data BLOB );
+CREATE TABLE favicons.moz_pages_w_icons ( id INTEGER PRIMARY KEY, page_url TEXT NOT NULL, page_url_hash INTEGER NOT NULL );
+CREATE TABLE favicons.moz_icons_to_pages ( page_id INTEGER NOT NULL, icon_id INTEGER NOT NULL, expire_ms INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (page_id, icon_id), FOREIGN KEY (page_id) REFERENCES moz_pages_w_icons ON DELETE CASCADE, FOREIGN KEY (icon_id) REFERENCES moz_icons ON DELETE CASCADE ) WITHOUT ROWID;
+
+-- Icon data is its description to tell them apart
+INSERT INTO favicons.moz_icons (id, icon_url, fixed_icon_url_hash, width, root, data) VALUES
+  (1, 'https://example.com/icon.png', 0, 32, 0, CAST('example 32' AS BLOB)),
+  (2, 'https://example.com/icon.png', 0, 16, 0, CAST('example 16' AS BLOB)),
+  (3, 'https://example.com/docs.png', 0, 8, 0, CAST('docs 8' AS BLOB)),
+  (4, 'https://example.com/docs.png', 0, 12, 0, CAST('docs 12' AS BLOB)),
+  (5, 'https://go.dev/favicon.ico', 0, 16, 1, CAST('go root 16' AS BLOB)),
+  (6, 'https://go.dev/favicon.ico', 0, 64, 1, CAST('go root 64' AS BLOB));
+INSERT INTO favicons.moz_pages_w_icons (id, page_url, page_url_hash) VALUES
+  (1, 'https://example.com/', 0),
+  (2, 'https://example.com/docs', 0);
+INSERT INTO favicons.moz_icons_to_pages (page_id, icon_id) VALUES (1, 1), (1, 2), (2, 3), (2, 4);
@@ -0,0 +1,140 @@
+// Package complete ranks address bar completions for typed input
+package complete
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Candidate is a possible completion
+type Candidate struct {
+	URL   string
+	Title string
+	// Higher is better, zero if never visited
+	Frecency float64
+	// True if the URL is open in a tab
+	OpenTab bool
+}
+
+// Kinds of matches, best first
+type MatchKind int
+
+const (
+	// URL (ignoring scheme and "www.") or title starts with the input
+	MatchPrefix MatchKind = iota
+	// URL or title contains the input
+	MatchSubstring
+	// URL or title contains the input's characters in order
+	MatchFuzzy
+)
+
+// Match is a matched candidate
+type Match struct {
+	Candidate
+	Kind MatchKind
+	// Orders matches of the same kind, higher is better
+	Score float64
+}
+
+// Engine ranks candidates. The zero value is usable.
+type Engine struct {
+	// Default is 10
+	MaxResults int
+	// Added to the frecency of open tabs. Default is 100.
+	OpenTabBonus float64
+}
+
+// Complete returns the best matching candidates, best first. Better kinds of
+// matches always come first, then the match quality weighted by frecency
+// orders matches of the same kind. Matching is case insensitive. Candidates
+// with the same URL should already be merged.
+func (e *Engine) Complete(input string, candidates []Candidate) []Match {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input == "" {
+		return nil
+	}
+	maxResults := e.MaxResults
+	if maxResults == 0 {
+		maxResults = 10
+	}
+	openTabBonus := e.OpenTabBonus
+	if openTabBonus == 0 {
+		openTabBonus = 100
+	}
+	var matches []Match
+	for _, c := range candidates {
+		kind, quality, ok := match(input, c)
+		if !ok {
+			continue
+		}
+		frecency := c.Frecency
+		if c.OpenTab {
+			frecency += openTabBonus
+		}
+		// Frecency orders within similar quality
+		score := (1 + quality) * (1 + math.Log1p(frecency))
+		matches = append(matches, Match{Candidate: c, Kind: kind, Score: score})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Kind != matches[j].Kind {
+			return matches[i].Kind < matches[j].Kind
+		} else if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].URL < matches[j].URL
+	})
+	if len(matches) > maxResults {
+		matches = matches[:maxResults]
+	}
+	return matches
+}
+
+// Returns the best match kind and a quality from 0 to 1 within it
+func match(input string, c Candidate) (MatchKind, float64, bool) {
+	url, title := strings.ToLower(c.URL), strings.ToLower(c.Title)
+	bare := StripURL(url)
+	// Shorter URLs are better for prefixes, since they're the typed ones
+	if strings.HasPrefix(bare, input) || strings.HasPrefix(url, input) {
+		return MatchPrefix, float64(len(input)) / float64(len(bare)+1), true
+	} else if strings.HasPrefix(title, input) {
+		return MatchPrefix, 0, true
+	}
+	if i := strings.Index(bare, input); i >= 0 {
+		return MatchSubstring, 1 / float64(i+1), true
+	} else if i := strings.Index(title, input); i >= 0 {
+		return MatchSubstring, 0.5 / float64(i+1), true
+	}
+	if q, ok := fuzzy(input, bare); ok {
+		return MatchFuzzy, q, true
+	} else if q, ok := fuzzy(input, title); ok {
+		return MatchFuzzy, q / 2, true
+	}
+	return 0, 0, false
+}
+
+// Checks that every rune of the input is in s in order. Quality is higher the
+// closer together they are.
+func fuzzy(input, s string) (float64, bool) {
+	start, pos := -1, 0
+	for _, r := range input {
+		i := strings.IndexRune(s[pos:], r)
+		if i < 0 {
+			return 0, false
+		}
+		if start < 0 {
+			start = pos + i
+		}
+		pos += i + utf8.RuneLen(r)
+	}
+	return float64(len(input)) / float64(pos-start), true
+}
+
+// StripURL removes the scheme and a leading "www." for matching
+func StripURL(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	}
+	return strings.TrimPrefix(url, "www.")
+}
@@ -0,0 +1,126 @@
+package complete
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		candidates []Candidate
+		expected   []string
+	}{
+		{
+			name:  "kinds in order",
+			input: "go",
+			candidates: []Candidate{
+				{URL: "https://example.com/gxo"},
+				{URL: "https://example.com/go"},
+				{URL: "https://golang.org/"},
+			},
+			expected: []string{"https://golang.org/", "https://example.com/go", "https://example.com/gxo"},
+		},
+		{
+			name:  "frecency doesn't outrank kind",
+			input: "go",
+			candidates: []Candidate{
+				{URL: "https://example.com/go", Frecency: 100000},
+				{URL: "https://example.com/g-o", Frecency: 100000, OpenTab: true},
+				{URL: "https://golang.org/"},
+			},
+			expected: []string{"https://golang.org/", "https://example.com/go", "https://example.com/g-o"},
+		},
+		{
+			name:  "open tab doesn't outrank kind",
+			input: "news",
+			candidates: []Candidate{
+				{URL: "https://example.com/news", OpenTab: true},
+				{URL: "https://news.example.com/"},
+			},
+			expected: []string{"https://news.example.com/", "https://example.com/news"},
+		},
+		{
+			name:  "frecency within kind",
+			input: "example",
+			candidates: []Candidate{
+				{URL: "https://example.com/a", Frecency: 1},
+				{URL: "https://example.com/b", Frecency: 50},
+				{URL: "https://www.example.com/c"},
+			},
+			expected: []string{"https://example.com/b", "https://example.com/a", "https://www.example.com/c"},
+		},
+		{
+			name:  "open tab within kind",
+			input: "example",
+			candidates: []Candidate{
+				{URL: "https://example.com/a", Frecency: 50},
+				{URL: "https://example.com/b", OpenTab: true},
+			},
+			expected: []string{"https://example.com/b", "https://example.com/a"},
+		},
+		{
+			name:  "shorter prefix with same frecency",
+			input: "exa",
+			candidates: []Candidate{
+				{URL: "https://example.com/some/long/path"},
+				{URL: "https://example.com/"},
+			},
+			expected: []string{"https://example.com/", "https://example.com/some/long/path"},
+		},
+		{
+			name:  "title matches",
+			input: "docs",
+			candidates: []Candidate{
+				{URL: "https://a.example.com/", Title: "Read the docs"},
+				{URL: "https://b.example.com/", Title: "Docs"},
+				{URL: "https://c.example.com/", Title: "Nothing"},
+			},
+			expected: []string{"https://b.example.com/", "https://a.example.com/"},
+		},
+		{
+			name:  "case insensitive",
+			input: " EXAMPLE ",
+			candidates: []Candidate{
+				{URL: "https://Example.com/"},
+			},
+			expected: []string{"https://Example.com/"},
+		},
+		{
+			name:  "ties by URL",
+			input: "example",
+			candidates: []Candidate{
+				{URL: "https://example.com/b"},
+				{URL: "https://example.com/a"},
+			},
+			expected: []string{"https://example.com/a", "https://example.com/b"},
+		},
+		{
+			name:       "empty input",
+			input:      " ",
+			candidates: []Candidate{{URL: "https://example.com/"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var actual []string
+			for _, m := range (&Engine{}).Complete(test.input, test.candidates) {
+				actual = append(actual, m.URL)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCompleteMaxResults(t *testing.T) {
+	var candidates []Candidate
+	for _, url := range []string{"https://a.example.com/", "https://b.example.com/", "https://c.example.com/"} {
+		candidates = append(candidates, Candidate{URL: url})
+	}
+	if matches := (&Engine{MaxResults: 2}).Complete("example", candidates); len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %v", len(matches))
+	}
+}
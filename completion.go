@@ -0,0 +1,74 @@
+package main
+
+import (
+	"time"
+
+	"github.com/cretz/ffembedpoc/complete"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+// Completes a tab's URL edit from history and open tabs. Methods must be
+// called on the main thread.
+type urlCompleter struct {
+	*browserTab
+	completer *widgets.QCompleter
+	model     *core.QStringListModel
+}
+
+func newURLCompleter(bt *browserTab) *urlCompleter {
+	u := &urlCompleter{browserTab: bt, model: core.NewQStringListModel(nil)}
+	u.completer = widgets.NewQCompleter2(u.model, bt.urlEditWidget)
+	// The engine does the filtering
+	u.completer.SetCompletionMode(widgets.QCompleter__UnfilteredPopupCompletion)
+	u.completer.SetMaxVisibleItems(10)
+	bt.urlEditWidget.SetCompleter(u.completer)
+	// The edit runs its completion after this, so the model is ready for it
+	bt.urlEditWidget.ConnectTextEdited(u.update)
+	u.completer.ConnectActivated(bt.navigateToInput)
+	return u
+}
+
+// True if a completion is selected in the popup. The edit sees return before
+// the completer does, so it should leave navigation to the completer.
+func (u *urlCompleter) choosing() bool {
+	popup := u.completer.Popup()
+	return popup.IsVisible() && popup.CurrentIndex().IsValid()
+}
+
+func (u *urlCompleter) update(text string) {
+	matches := u.completions.Complete(text, u.candidates())
+	urls := make([]string, len(matches))
+	for i, match := range matches {
+		urls[i] = match.URL
+	}
+	u.model.SetStringList(urls)
+}
+
+// History entries with open tabs merged in
+func (u *urlCompleter) candidates() []complete.Candidate {
+	now := time.Now()
+	entries := u.history.Entries()
+	candidates := make([]complete.Candidate, 0, len(entries))
+	indexes := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		indexes[entry.URL] = len(candidates)
+		candidates = append(candidates, complete.Candidate{
+			URL:      entry.URL,
+			Title:    entry.Title,
+			Frecency: entry.Frecency(now),
+		})
+	}
+	for _, tab := range u.firefox.Tabs() {
+		if tab.ID == u.tab.ID || tab.URL() == "" {
+			continue
+		}
+		if i, ok := indexes[tab.URL()]; ok {
+			candidates[i].OpenTab = true
+		} else {
+			indexes[tab.URL()] = len(candidates)
+			candidates = append(candidates, complete.Candidate{URL: tab.URL(), Title: tab.Title(), OpenTab: true})
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cretz/ffembedpoc/firefox"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+// Lines kept in the console panel, older ones are dropped
+const consoleMaxLines = 1000
+
+// Dock showing console messages and page errors of every tab. Methods must be
+// called on the main thread.
+type consolePanel struct {
+	*browser
+	dock *widgets.QDockWidget
+	text *widgets.QPlainTextEdit
+}
+
+func newConsolePanel(b *browser, window *widgets.QMainWindow) *consolePanel {
+	p := &consolePanel{
+		browser: b,
+		dock:    widgets.NewQDockWidget("Console", window, 0),
+		text:    widgets.NewQPlainTextEdit(nil),
+	}
+	p.text.SetReadOnly(true)
+	p.text.SetMaximumBlockCount(consoleMaxLines)
+	p.text.SetLineWrapMode(widgets.QPlainTextEdit__NoWrap)
+	p.dock.SetWidget(p.text)
+	p.dock.Hide()
+	window.AddDockWidget(core.Qt__BottomDockWidgetArea, p.dock)
+	menu := window.MenuBar().AddMenu2("&Console")
+	menu.AddActions([]*widgets.QAction{p.dock.ToggleViewAction()})
+	menu.AddAction("Clear").ConnectTriggered(func(bool) { p.text.Clear() })
+	return p
+}
+
+// Shows the tab's messages in the background until the tab is closed
+func (p *consolePanel) watch(tab *firefox.TabActor) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-tab.Done()
+		cancel()
+	}()
+	go func() {
+		msgs, err := tab.ConsoleMessages(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.log.Errorf("Failed watching console of %v: %v", tab.ID, err)
+			}
+			return
+		}
+		for msg := range msgs {
+			line := fmt.Sprintf("[%v] %v: %v", tab.Title(), msg.Level, msg.Text)
+			if msg.SourceURL != "" {
+				line += fmt.Sprintf(" (%v:%v)", msg.SourceURL, msg.Line)
+			}
+			runOnMain(func() { p.text.AppendPlainText(line) })
+		}
+	}()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/cretz/ffembedpoc/firefox"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+const downloadDir = "downloads"
+
+const (
+	downloadColumnFile = iota
+	downloadColumnStatus
+	downloadColumnURL
+)
+
+// Dock listing downloads, shown when one starts. Methods must be called on the
+// main thread.
+type downloadsPanel struct {
+	*browser
+	dock  *widgets.QDockWidget
+	tree  *widgets.QTreeWidget
+	items map[int]*widgets.QTreeWidgetItem
+}
+
+func newDownloadsPanel(b *browser, window *widgets.QMainWindow) *downloadsPanel {
+	p := &downloadsPanel{
+		browser: b,
+		dock:    widgets.NewQDockWidget("Downloads", window, 0),
+		tree:    widgets.NewQTreeWidget(nil),
+		items:   map[int]*widgets.QTreeWidgetItem{},
+	}
+	p.tree.SetHeaderLabels([]string{"File", "Status", "URL"})
+	p.tree.SetRootIsDecorated(false)
+	// The full path is the file tooltip
+	p.tree.ConnectItemDoubleClicked(func(item *widgets.QTreeWidgetItem, _ int) {
+		openLocalFile(item.ToolTip(downloadColumnFile))
+	})
+	p.dock.SetWidget(p.tree)
+	p.dock.Hide()
+	window.AddDockWidget(core.Qt__BottomDockWidgetArea, p.dock)
+	menu := window.MenuBar().AddMenu2("&Downloads")
+	menu.AddActions([]*widgets.QAction{p.dock.ToggleViewAction()})
+	menu.AddAction("Open Downloads Folder").ConnectTriggered(func(bool) { openLocalFile(downloadDir) })
+	menu.AddAction("Clear List").ConnectTriggered(func(bool) {
+		p.tree.Clear()
+		p.items = map[int]*widgets.QTreeWidgetItem{}
+	})
+	return p
+}
+
+// Watches downloads in the background until the context is done
+func (p *downloadsPanel) start(ctx context.Context) {
+	go func() {
+		events, err := p.firefox.WatchDownloads(ctx)
+		if err != nil {
+			p.log.Errorf("Failed watching downloads: %v", err)
+			return
+		}
+		for ev := range events {
+			ev := ev
+			if ev.Type != firefox.DownloadProgress {
+				p.log.Infof("Download %v: %v to %v", ev.Type, ev.URL, ev.Path)
+			}
+			runOnMain(func() { p.update(ev) })
+		}
+	}()
+}
+
+func (p *downloadsPanel) update(ev firefox.DownloadEvent) {
+	item := p.items[ev.ID]
+	if item == nil {
+		item = widgets.NewQTreeWidgetItem2([]string{"", "", ""}, 0)
+		p.tree.InsertTopLevelItem(0, item)
+		p.items[ev.ID] = item
+	}
+	if ev.Type == firefox.DownloadStarted {
+		p.dock.Show()
+	}
+	item.SetText(downloadColumnFile, filepath.Base(ev.Path))
+	item.SetToolTip(downloadColumnFile, ev.Path)
+	item.SetText(downloadColumnStatus, downloadStatus(ev))
+	item.SetText(downloadColumnURL, ev.URL)
+}
+
+func downloadStatus(ev firefox.DownloadEvent) string {
+	switch ev.Type {
+	case firefox.DownloadCompleted:
+		return "Done, " + byteSize(ev.CurrentBytes)
+	case firefox.DownloadFailed:
+		return "Failed: " + ev.Error
+	}
+	if ev.TotalBytes <= 0 {
+		return byteSize(ev.CurrentBytes)
+	}
+	return fmt.Sprintf("%d%% of %v", ev.CurrentBytes*100/ev.TotalBytes, byteSize(ev.TotalBytes))
+}
+
+func byteSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+func openLocalFile(path string) {
+	if path == "" {
+		return
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	gui.QDesktopServices_OpenUrl(core.QUrl_FromLocalFile(path))
+}
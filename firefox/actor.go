@@ -2,6 +2,8 @@ package firefox
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"sync"
 )
 
@@ -31,7 +33,7 @@ func (r *RootActor) Tabs() []*TabActor {
 }
 
 func (r *RootActor) send(msg *actorMessage) error {
-	if err := r.mgr.firefox.remote.send(msg); err != nil {
+	if err := r.mgr.send(msg, nil); err != nil {
 		r.mgr.firefox.log.Errorf("failed sending: %v", err)
 		return err
 	}
@@ -40,6 +42,14 @@ func (r *RootActor) send(msg *actorMessage) error {
 
 func (r *RootActor) onMessage(msg *actorMessage) {
 	switch {
+	case msg.ApplicationType != "":
+		// The hello packet is only sent once on connect
+		select {
+		case <-r.mgr.firefox.helloCh:
+		default:
+			r.mgr.firefox.ServerInfo = &ServerInfo{ApplicationType: msg.ApplicationType, Traits: msg.Traits}
+			close(r.mgr.firefox.helloCh)
+		}
 	case msg.Type == "tabListChanged":
 		// On tab list change, we have to list the tabs
 		r.send(&actorMessage{To: "root", Type: "listTabs"})
@@ -63,6 +73,16 @@ func (r *RootActor) onMessage(msg *actorMessage) {
 			newTabs[i] = tab
 			tab.updateFromDescriptor(msgTab)
 		}
+		// Tabs no longer listed are gone
+		for _, existingTab := range r.tabs {
+			found := false
+			for _, tab := range newTabs {
+				found = found || tab == existingTab
+			}
+			if !found {
+				existingTab.cancel()
+			}
+		}
 		// If any were changed (added or changes spots), copy on write
 		changed := len(newTabs) != len(r.tabs)
 		if !changed {
@@ -87,6 +107,8 @@ func (r *RootActor) removeTab(id string) {
 	for _, tab := range r.tabs {
 		if tab.ID != id {
 			newTabs = append(newTabs, tab)
+		} else {
+			tab.cancel()
 		}
 	}
 	if len(newTabs) != len(r.tabs) {
@@ -103,6 +125,9 @@ type TabActor struct {
 	FaviconChangedListener EventListener
 
 	root *RootActor
+	// Done when the tab is detached or no longer listed
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	// Governs fields just below it
 	fieldsLock sync.RWMutex
@@ -112,17 +137,63 @@ type TabActor struct {
 	url        string
 	navigating bool
 
+	screenshotActor string
+	inspectorActor  string
+	storageActor    string
+	threadActor     string
+	consoleActor    string
+	// Incremented each time a navigation stops, i.e. a new document loaded
+	documentGen int
+	// Of the tab's browser element, for chrome evaluation
+	browserID     int
+	outerWindowID int
+
+	// Best-effort session history, see recordHistoryUnlocked
+	history      []string
+	historyIndex int
+	historyMove  int
+	// From the browser's session history, see loadSessionHistoryUnlocked
+	sessionHistoryKnown bool
+	canGoBack           bool
+	canGoForward        bool
+	// Set by NavigateTo until the navigation stops
+	navigateToPending bool
+	// Set if NavigateTo was called before the frame was known
+	navigateToURL  string
+	lastTransition Transition
+
 	faviconLock sync.RWMutex
 	favicon     []byte
+
+	watcher     *watcherActor
+	watcherLock sync.Mutex
+
+	network     *networkMonitor
+	networkLock sync.Mutex
+
+	console     *consoleMonitor
+	consoleLock sync.Mutex
+
+	walker     *walker
+	walkerLock sync.Mutex
 }
 
 func newTabActor(root *RootActor, id string) *TabActor {
 	tab := &TabActor{ID: id, root: root}
+	tab.ctx, tab.cancel = context.WithCancel(root.mgr.firefox.runCtx)
 	// Set myself on the ID
 	root.mgr.setActor(tab.ID, tab)
+	if root.mgr.firefox.config.LogConsoleMessages {
+		go tab.logConsoleMessages()
+	}
 	return tab
 }
 
+// Done is closed when the tab is closed or Firefox is
+func (t *TabActor) Done() <-chan struct{} {
+	return t.ctx.Done()
+}
+
 func (t *TabActor) Selected() bool {
 	t.fieldsLock.RLock()
 	defer t.fieldsLock.RUnlock()
@@ -159,9 +230,16 @@ func (t *TabActor) SetFocus() {
 	t.root.send(&actorMessage{To: t.frameID, Type: "focus"})
 }
 
+// NavigateTo navigates the tab to the URL. If the tab's target isn't known
+// yet, this is done once it is.
 func (t *TabActor) NavigateTo(url string) {
-	t.fieldsLock.RLock()
-	defer t.fieldsLock.RUnlock()
+	t.fieldsLock.Lock()
+	defer t.fieldsLock.Unlock()
+	t.navigateToPending = true
+	if t.frameID == "" {
+		t.navigateToURL = url
+		return
+	}
 	t.root.send(&actorMessage{To: t.frameID, Type: "navigateTo", URL: url})
 }
 
@@ -173,14 +251,21 @@ func (t *TabActor) onMessage(msg *actorMessage) {
 		t.updateFromTabNavigated(msg)
 	case msg.Type == "tabDetached":
 		t.root.removeTab(t.ID)
-	case msg.Favicon.set:
-		t.updateFavicon(msg.Favicon.bytes)
+	case len(msg.Favicon) > 0:
+		// Null is no favicon
+		var favicon []byte
+		if err := json.Unmarshal(msg.Favicon, &favicon); err != nil {
+			t.root.mgr.firefox.log.Errorf("Invalid favicon for %v: %v", t.ID, err)
+			return
+		}
+		t.updateFavicon(favicon)
 	}
 }
 
 func (t *TabActor) updateFromDescriptor(msg *actorTab) {
 	t.fieldsLock.Lock()
 	defer t.fieldsLock.Unlock()
+	t.browserID, t.outerWindowID = msg.BrowserID, msg.OuterWindowID
 	// TODO: Handle missing title
 	t.updateFieldsUnlocked(msg.Selected, msg.Title, msg.URL, t.navigating)
 	// Ask for the new target
@@ -200,6 +285,19 @@ func (t *TabActor) updateFromFrame(msg *actorFrame) {
 		t.frameID = msg.Actor
 		t.root.mgr.setActor(t.frameID, t)
 		t.root.send(&actorMessage{To: t.frameID, Type: "attach"})
+		if t.navigateToURL != "" {
+			t.root.send(&actorMessage{To: t.frameID, Type: "navigateTo", URL: t.navigateToURL})
+			t.navigateToURL = ""
+		}
+	}
+	t.screenshotActor = msg.ScreenshotActor
+	t.inspectorActor = msg.InspectorActor
+	t.storageActor = msg.StorageActor
+	t.threadActor = msg.ThreadActor
+	t.consoleActor = msg.ConsoleActor
+	// Seed history with the first URL seen
+	if len(t.history) == 0 && msg.URL != "" {
+		t.history = []string{msg.URL}
 	}
 	// Update any other fields that may have changed
 	t.updateFieldsUnlocked(t.selected, msg.Title, msg.URL, t.navigating)
@@ -208,6 +306,16 @@ func (t *TabActor) updateFromFrame(msg *actorFrame) {
 func (t *TabActor) updateFromTabNavigated(msg *actorMessage) {
 	t.fieldsLock.Lock()
 	defer t.fieldsLock.Unlock()
+	// Blocked navigations don't change state
+	if (msg.State == "start" || msg.State == "stop") && t.enforcePolicyUnlocked(msg.State, msg.URL) {
+		return
+	}
+	// Record history before listeners see the new state
+	if msg.State == "stop" {
+		t.documentGen++
+		t.recordHistoryUnlocked(msg.URL)
+		t.loadSessionHistoryUnlocked()
+	}
 	t.updateFieldsUnlocked(t.selected, msg.Title, msg.URL, msg.State == "start")
 	// If the state is stop, ask for the favicon
 	if msg.State == "stop" {
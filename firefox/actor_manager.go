@@ -2,6 +2,8 @@ package firefox
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"sync"
 )
 
@@ -9,14 +11,69 @@ type actorManager struct {
 	firefox    *Firefox
 	actors     map[string]Actor
 	actorsLock sync.RWMutex
+	// Closed when run completes
+	doneCh chan struct{}
+
+	// Keyed by actor ID, FIFO since replies from an actor are in request order
+	pending     map[string][]*pendingReply
+	pendingLock sync.Mutex
+
+	subs     map[actorSub]map[chan json.RawMessage]struct{}
+	subsLock sync.RWMutex
+
+	// Keyed by actor instance instead of ID since an actor may have multiple
+	// IDs but still needs its messages in order. Only present while running.
+	mailboxes     map[Actor]*mailbox
+	mailboxesLock sync.Mutex
+}
+
+// Queue length at which a mailbox backlog is logged, then again each time it
+// doubles. Must be a power of two.
+const mailboxBacklogLogSize = 1024
+
+// Messages for a single actor, handled in order by a goroutine that only runs
+// while there are messages
+type mailbox struct {
+	actor Actor
+	queue []*actorMessage
+}
+
+type actorSub struct {
+	actor string
+	// Empty means all types
+	typ string
+}
+
+type pendingReply struct {
+	// Nil means the reply goes to onMessage
+	ch chan<- *actorMessage
+	// If true, the next packet is the reply even if it has a type
+	anyType bool
+	// If set, a packet with this type is also a reply
+	replyType string
+	// Set when the requester stops waiting. The entry stays so later replies
+	// from the actor still match their requests, and its reply is dropped.
+	abandoned bool
 }
 
+// Types of packets that are replies even though they have a type
+var replyTypes = map[string]bool{"tabAttached": true, "detached": true}
+
 func (f *Firefox) newActorManager() *actorManager {
-	return &actorManager{firefox: f, actors: map[string]Actor{}}
+	return &actorManager{
+		firefox: f,
+		actors:  map[string]Actor{},
+		doneCh:  make(chan struct{}),
+		pending: map[string][]*pendingReply{},
+		subs:    map[actorSub]map[chan json.RawMessage]struct{}{},
+
+		mailboxes: map[Actor]*mailbox{},
+	}
 }
 
 // Returns nil when done
 func (a *actorManager) run() error {
+	defer close(a.doneCh)
 	// Continually receive messages
 	for {
 		// Get next message
@@ -27,15 +84,226 @@ func (a *actorManager) run() error {
 			}
 			return err
 		}
+		// Send to the waiting request if there is one
+		if replyCh, abandoned := a.popPending(&msg); abandoned {
+			a.firefox.log.Debugf("Dropping reply from %v to abandoned request", msg.From)
+			continue
+		} else if replyCh != nil {
+			replyCh <- &msg
+			continue
+		}
+		a.notifySubs(&msg)
 		a.actorsLock.RLock()
 		actor := a.actors[msg.From]
 		a.actorsLock.RUnlock()
 		if actor != nil {
-			actor.onMessage(&msg)
+			a.dispatch(actor, &msg)
+		}
+	}
+}
+
+// Queues the message for the actor so a slow actor doesn't block others
+func (a *actorManager) dispatch(actor Actor, msg *actorMessage) {
+	a.mailboxesLock.Lock()
+	defer a.mailboxesLock.Unlock()
+	box := a.mailboxes[actor]
+	if box != nil {
+		box.queue = append(box.queue, msg)
+		// Messages aren't dropped since actors rely on order, but a growing
+		// backlog means the actor can't keep up
+		if n := len(box.queue); n >= mailboxBacklogLogSize && n&(n-1) == 0 {
+			a.firefox.log.Errorf("Actor for %v has %v messages queued", msg.From, n)
+		}
+		return
+	}
+	box = &mailbox{actor: actor, queue: []*actorMessage{msg}}
+	a.mailboxes[actor] = box
+	go a.drain(box)
+}
+
+func (a *actorManager) drain(box *mailbox) {
+	for {
+		// Remove the mailbox when empty so the next dispatch starts a new one
+		a.mailboxesLock.Lock()
+		if len(box.queue) == 0 {
+			delete(a.mailboxes, box.actor)
+			a.mailboxesLock.Unlock()
+			return
 		}
+		msg := box.queue[0]
+		box.queue[0] = nil
+		box.queue = box.queue[1:]
+		a.mailboxesLock.Unlock()
+		box.actor.onMessage(msg)
 	}
 }
 
+func (a *actorManager) notifySubs(msg *actorMessage) {
+	a.subsLock.RLock()
+	defer a.subsLock.RUnlock()
+	for _, sub := range []actorSub{{msg.From, msg.Type}, {msg.From, ""}} {
+		for ch := range a.subs[sub] {
+			select {
+			case ch <- msg.raw:
+			default:
+			}
+		}
+		// Don't send twice for untyped
+		if msg.Type == "" {
+			break
+		}
+	}
+}
+
+func (a *actorManager) subscribe(actor, typ string) <-chan json.RawMessage {
+	ch := make(chan json.RawMessage, 100)
+	sub := actorSub{actor, typ}
+	a.subsLock.Lock()
+	defer a.subsLock.Unlock()
+	if a.subs[sub] == nil {
+		a.subs[sub] = map[chan json.RawMessage]struct{}{}
+	}
+	a.subs[sub][ch] = struct{}{}
+	return ch
+}
+
+func (a *actorManager) unsubscribe(ch <-chan json.RawMessage) {
+	a.subsLock.Lock()
+	defer a.subsLock.Unlock()
+	for sub, chans := range a.subs {
+		for subCh := range chans {
+			if subCh == ch {
+				delete(chans, subCh)
+				close(subCh)
+				if len(chans) == 0 {
+					delete(a.subs, sub)
+				}
+				return
+			}
+		}
+	}
+}
+
+// Sends the message. If replyCh is non-nil (and should have a buffer), the
+// reply is sent to it instead of the actor's onMessage.
+func (a *actorManager) send(msg *actorMessage, replyCh chan<- *actorMessage) error {
+	return a.sendPending(msg.To, msg, &pendingReply{ch: replyCh})
+}
+
+// Packet must marshal with "to" set to the given actor
+func (a *actorManager) sendPending(to string, packet interface{}, reply *pendingReply) error {
+	// Lock held during send so the reply can't be read before it's pending
+	a.pendingLock.Lock()
+	defer a.pendingLock.Unlock()
+	if err := a.firefox.remote.send(packet); err != nil {
+		return err
+	}
+	a.pending[to] = append(a.pending[to], reply)
+	return nil
+}
+
+// Sends the message and waits for the reply. This can be called from
+// onMessage, but other messages for that actor wait until it completes.
+func (a *actorManager) request(ctx context.Context, msg *actorMessage) (*actorMessage, error) {
+	return a.requestPending(ctx, msg, false)
+}
+
+// Same as request but for actors that don't send events and whose replies
+// may have a type
+func (a *actorManager) requestAnyType(ctx context.Context, msg *actorMessage) (*actorMessage, error) {
+	return a.requestPending(ctx, msg, true)
+}
+
+// Same as request but for replies that may have the given type, e.g. some
+// thread actor replies. Events of that type can't be told apart from the
+// reply.
+func (a *actorManager) requestReplyType(ctx context.Context, msg *actorMessage, replyType string) (*actorMessage, error) {
+	return a.requestReply(ctx, msg.To, msg, &pendingReply{replyType: replyType})
+}
+
+func (a *actorManager) requestPending(ctx context.Context, msg *actorMessage, anyType bool) (*actorMessage, error) {
+	return a.requestPacket(ctx, msg.To, msg, anyType)
+}
+
+func (a *actorManager) requestPacket(ctx context.Context, to string, packet interface{}, anyType bool) (*actorMessage, error) {
+	return a.requestReply(ctx, to, packet, &pendingReply{anyType: anyType})
+}
+
+// The pending reply's channel is set here
+func (a *actorManager) requestReply(
+	ctx context.Context,
+	to string,
+	packet interface{},
+	pending *pendingReply,
+) (*actorMessage, error) {
+	replyCh := make(chan *actorMessage, 1)
+	pending.ch = replyCh
+	if err := a.sendPending(to, packet, pending); err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		a.abandon(pending)
+		return nil, ctx.Err()
+	case <-a.doneCh:
+		return nil, fmt.Errorf("connection closed")
+	case reply := <-replyCh:
+		if reply.Error != "" {
+			return nil, &ActorError{Actor: reply.From, Err: reply.Error, Message: reply.Message}
+		}
+		return reply, nil
+	}
+}
+
+// Accepts either a JSON string or a long string grip
+func (a *actorManager) resolveString(ctx context.Context, v json.RawMessage) (string, error) {
+	var str string
+	if err := json.Unmarshal(v, &str); err == nil {
+		return str, nil
+	}
+	var grip actorLongString
+	if err := json.Unmarshal(v, &grip); err != nil {
+		return "", fmt.Errorf("invalid string: %w", err)
+	} else if grip.Type != "longString" {
+		return "", fmt.Errorf("expected long string, got %v", grip.Type)
+	}
+	start, end := 0, grip.Length
+	reply, err := a.request(ctx, &actorMessage{To: grip.Actor, Type: "substring", Start: &start, End: &end})
+	if err != nil {
+		return "", fmt.Errorf("failed getting long string: %w", err)
+	}
+	return reply.Substring, nil
+}
+
+func (a *actorManager) abandon(reply *pendingReply) {
+	a.pendingLock.Lock()
+	defer a.pendingLock.Unlock()
+	reply.abandoned = true
+	reply.ch = nil
+}
+
+// Channel is nil if not a reply or the reply is not waited on. Abandoned is
+// true if the reply was for a request no longer waited on.
+func (a *actorManager) popPending(msg *actorMessage) (replyCh chan<- *actorMessage, abandoned bool) {
+	a.pendingLock.Lock()
+	defer a.pendingLock.Unlock()
+	pending := a.pending[msg.From]
+	if len(pending) == 0 {
+		return nil, false
+	} else if !pending[0].anyType && msg.Type != "" && msg.Error == "" && !replyTypes[msg.Type] &&
+		msg.Type != pending[0].replyType {
+		return nil, false
+	}
+	reply := pending[0]
+	if len(pending) == 1 {
+		delete(a.pending, msg.From)
+	} else {
+		pending[0] = nil
+		a.pending[msg.From] = pending[1:]
+	}
+	return reply.ch, reply.abandoned
+}
+
 func (a *actorManager) setActor(id string, actor Actor) {
 	a.actorsLock.Lock()
 	defer a.actorsLock.Unlock()
@@ -48,6 +316,20 @@ func (a *actorManager) removeActor(id string) {
 	delete(a.actors, id)
 }
 
+// ActorError is an error reply from an actor
+type ActorError struct {
+	Actor   string
+	Err     string
+	Message string
+}
+
+func (a *ActorError) Error() string {
+	if a.Message == "" {
+		return fmt.Sprintf("actor %v failed: %v", a.Actor, a.Err)
+	}
+	return fmt.Sprintf("actor %v failed: %v - %v", a.Actor, a.Err, a.Message)
+}
+
 type EventListener struct {
 	chans     map[chan<- struct{}]struct{}
 	chansLock sync.RWMutex
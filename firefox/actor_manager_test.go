@@ -0,0 +1,394 @@
+package firefox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Firefox with only a remote over a pipe, the other end of which is returned
+func newTestRemote(tb testing.TB) (*Firefox, net.Conn) {
+	clientConn, serverConn := net.Pipe()
+	f := &Firefox{
+		config:  Config{Log: zap.NewNop().Sugar(), MaxPacketSize: 64 * 1024 * 1024},
+		helloCh: make(chan struct{}),
+	}
+	f.log = f.config.Log
+	f.runCtx, f.runCancel = context.WithCancel(context.Background())
+	f.remote = f.newRemote(clientConn)
+	tb.Cleanup(func() {
+		f.closeConnection()
+		serverConn.Close()
+	})
+	return f, serverConn
+}
+
+// Fake remote debugging server for a Firefox whose actor manager is running
+type fakeServer struct {
+	tb   testing.TB
+	conn net.Conn
+	// Packets from the client, closed when the connection is
+	recvCh chan map[string]interface{}
+}
+
+func newTestFirefox(tb testing.TB) (*Firefox, *fakeServer) {
+	f, conn := newTestRemote(tb)
+	f.mgr = f.newActorManager()
+	f.mgr.setActor("root", &f.RootActor)
+	f.Client = &Client{mgr: f.mgr}
+	s := &fakeServer{tb: tb, conn: conn, recvCh: make(chan map[string]interface{}, 10000)}
+	go s.readPackets()
+	go f.mgr.run()
+	// Cleanups run last first, so this has to close before waiting
+	tb.Cleanup(func() {
+		f.closeConnection()
+		<-f.mgr.doneCh
+	})
+	return f, s
+}
+
+func (s *fakeServer) readPackets() {
+	defer close(s.recvCh)
+	r := bufio.NewReader(s.conn)
+	for {
+		size, err := ReadPacketHeader(r, 64*1024*1024)
+		if err != nil {
+			return
+		}
+		b := make([]byte, size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return
+		}
+		var packet map[string]interface{}
+		if err := json.Unmarshal(b, &packet); err != nil {
+			return
+		}
+		s.recvCh <- packet
+	}
+}
+
+// Next packet from the client, failing if none comes
+func (s *fakeServer) next() map[string]interface{} {
+	s.tb.Helper()
+	select {
+	case packet, ok := <-s.recvCh:
+		if !ok {
+			s.tb.Fatal("connection closed")
+		}
+		return packet
+	case <-time.After(5 * time.Second):
+		s.tb.Fatal("timed out waiting for packet")
+	}
+	return nil
+}
+
+// Next packet from the client, which must be to the actor with the type
+func (s *fakeServer) expect(to, typ string) map[string]interface{} {
+	s.tb.Helper()
+	packet := s.next()
+	if packet["to"] != to || packet["type"] != typ {
+		s.tb.Fatalf("expected %v to %v, got %v", typ, to, packet)
+	}
+	return packet
+}
+
+func (s *fakeServer) send(packets ...interface{}) {
+	s.tb.Helper()
+	if _, err := s.conn.Write(framePackets(s.tb, packets...)); err != nil {
+		s.tb.Fatal(err)
+	}
+}
+
+func framePackets(tb testing.TB, packets ...interface{}) []byte {
+	tb.Helper()
+	var framed []byte
+	for _, packet := range packets {
+		b, err := json.Marshal(packet)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		framed = strconv.AppendInt(framed, int64(len(b)), 10)
+		framed = append(framed, ':')
+		framed = append(framed, b...)
+	}
+	return framed
+}
+
+// Records messages and calls the func if set
+type testActor struct {
+	fn   func(*actorMessage)
+	lock sync.Mutex
+	msgs []*actorMessage
+}
+
+func (t *testActor) onMessage(msg *actorMessage) {
+	t.lock.Lock()
+	t.msgs = append(t.msgs, msg)
+	t.lock.Unlock()
+	if t.fn != nil {
+		t.fn(msg)
+	}
+}
+
+func (t *testActor) types() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	types := make([]string, len(t.msgs))
+	for i, msg := range t.msgs {
+		types[i] = msg.Type
+	}
+	return types
+}
+
+// Waits for the condition, failing if it doesn't happen
+func waitFor(tb testing.TB, desc string, cond func() bool) {
+	tb.Helper()
+	for start := time.Now(); !cond(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			tb.Fatalf("timed out waiting for %v", desc)
+		}
+	}
+}
+
+type requestResult struct {
+	reply *actorMessage
+	err   error
+}
+
+func requestAsync(ctx context.Context, f *Firefox, msg *actorMessage) <-chan requestResult {
+	ch := make(chan requestResult, 1)
+	go func() {
+		reply, err := f.mgr.request(ctx, msg)
+		ch <- requestResult{reply, err}
+	}()
+	return ch
+}
+
+func TestActorManagerRequest(t *testing.T) {
+	f, s := newTestFirefox(t)
+	actor := &testActor{}
+	f.mgr.setActor("actor1", actor)
+	resultCh := requestAsync(context.Background(), f, &actorMessage{To: "actor1", Type: "ping"})
+	s.expect("actor1", "ping")
+	// Typed packets are events, not the reply
+	s.send(
+		map[string]interface{}{"from": "actor1", "type": "someEvent"},
+		map[string]interface{}{"from": "actor1", "value": "pong"},
+	)
+	res := <-resultCh
+	if res.err != nil {
+		t.Fatal(res.err)
+	} else if string(res.reply.Value) != `"pong"` {
+		t.Fatalf("unexpected reply %s", res.reply.raw)
+	}
+	waitFor(t, "event", func() bool { return len(actor.types()) == 1 })
+	if types := actor.types(); types[0] != "someEvent" {
+		t.Fatalf("unexpected messages %v", types)
+	}
+	// Errors are replies too
+	resultCh = requestAsync(context.Background(), f, &actorMessage{To: "actor1", Type: "ping"})
+	s.expect("actor1", "ping")
+	s.send(map[string]interface{}{"from": "actor1", "error": "noSuchActor", "message": "gone"})
+	if res := <-resultCh; res.err == nil || res.err.Error() != "actor actor1 failed: noSuchActor - gone" {
+		t.Fatalf("unexpected error %v", res.err)
+	}
+}
+
+func TestActorManagerRequestCanceled(t *testing.T) {
+	f, s := newTestFirefox(t)
+	actor := &testActor{}
+	f.mgr.setActor("actor1", actor)
+	ctx, cancel := context.WithCancel(context.Background())
+	resultCh := requestAsync(ctx, f, &actorMessage{To: "actor1", Type: "first"})
+	s.expect("actor1", "first")
+	cancel()
+	if res := <-resultCh; res.err != context.Canceled {
+		t.Fatalf("expected cancel, got %v", res.err)
+	}
+	// The late reply to the first must not be taken as the reply to the second
+	resultCh = requestAsync(context.Background(), f, &actorMessage{To: "actor1", Type: "second"})
+	s.expect("actor1", "second")
+	s.send(
+		map[string]interface{}{"from": "actor1", "value": "first"},
+		map[string]interface{}{"from": "actor1", "value": "second"},
+	)
+	if res := <-resultCh; res.err != nil {
+		t.Fatal(res.err)
+	} else if string(res.reply.Value) != `"second"` {
+		t.Fatalf("unexpected reply %s", res.reply.raw)
+	}
+	// Nor given to the actor, which gets messages in order
+	s.send(map[string]interface{}{"from": "actor1", "type": "someEvent"})
+	waitFor(t, "event", func() bool { return len(actor.types()) > 0 })
+	if types := actor.types(); len(types) != 1 || types[0] != "someEvent" {
+		t.Fatalf("unexpected messages %v", types)
+	}
+	f.mgr.pendingLock.Lock()
+	defer f.mgr.pendingLock.Unlock()
+	if len(f.mgr.pending) != 0 {
+		t.Fatalf("pending replies left: %v", f.mgr.pending)
+	}
+}
+
+func TestActorManagerRequestReplyType(t *testing.T) {
+	f, s := newTestFirefox(t)
+	actor := &testActor{}
+	f.mgr.setActor("thread1", actor)
+	resultCh := make(chan requestResult, 1)
+	go func() {
+		reply, err := f.mgr.requestReplyType(context.Background(), &actorMessage{To: "thread1", Type: "resume"}, "resumed")
+		resultCh <- requestResult{reply, err}
+	}()
+	s.expect("thread1", "resume")
+	s.send(
+		map[string]interface{}{"from": "thread1", "type": "newSource"},
+		map[string]interface{}{"from": "thread1", "type": "resumed"},
+	)
+	if res := <-resultCh; res.err != nil {
+		t.Fatal(res.err)
+	} else if res.reply.Type != "resumed" {
+		t.Fatalf("unexpected reply %s", res.reply.raw)
+	}
+	waitFor(t, "event", func() bool { return len(actor.types()) == 1 })
+	if types := actor.types(); types[0] != "newSource" {
+		t.Fatalf("unexpected messages %v", types)
+	}
+}
+
+// Lists the tabs and answers their target requests
+func beginTestTabs(t *testing.T, f *Firefox, s *fakeServer, count int) {
+	t.Helper()
+	if err := f.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	s.expect("root", "listTabs")
+	tabs := make([]map[string]interface{}, count)
+	for i := range tabs {
+		tabs[i] = map[string]interface{}{"actor": fmt.Sprintf("tab%v", i), "url": "about:blank"}
+	}
+	s.send(map[string]interface{}{"from": "root", "tabs": tabs})
+	// Every tab gets its target then attaches to it
+	for i := 0; i < count*2; i++ {
+		packet := s.next()
+		to, _ := packet["to"].(string)
+		switch packet["type"] {
+		case "getTarget":
+			s.send(map[string]interface{}{"from": to, "frame": map[string]interface{}{
+				"actor": "frame-" + to,
+				"url":   "about:blank",
+			}})
+		case "attach":
+		default:
+			t.Fatalf("unexpected packet %v", packet)
+		}
+	}
+	waitFor(t, "tabs", func() bool { return len(f.Tabs()) == count })
+}
+
+func TestActorManagerManyTabsNotBlockedBySlowActor(t *testing.T) {
+	const tabCount = 300
+	f, s := newTestFirefox(t)
+	beginTestTabs(t, f, s, tabCount)
+	// Block an actor until every tab has its event
+	release := make(chan struct{})
+	slow := &testActor{fn: func(*actorMessage) { <-release }}
+	f.mgr.setActor("slow", slow)
+	defer close(release)
+	packets := []interface{}{
+		map[string]interface{}{"from": "slow", "type": "event"},
+		map[string]interface{}{"from": "slow", "type": "event"},
+	}
+	for i := 0; i < tabCount; i++ {
+		packets = append(packets, map[string]interface{}{
+			"from":  fmt.Sprintf("frame-tab%v", i),
+			"type":  "tabNavigated",
+			"state": "start",
+			"url":   fmt.Sprintf("https://example.com/%v", i),
+		})
+	}
+	s.send(packets...)
+	waitFor(t, "tab navigations", func() bool {
+		for i, tab := range f.Tabs() {
+			if tab.URL() != fmt.Sprintf("https://example.com/%v", i) || !tab.Navigating() {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Time for a batch of events to reach hundreds of fast actors while one actor
+// is slow. Serial is handling each message as it's read like before
+// mailboxes.
+func BenchmarkActorDispatchSlowActor(b *testing.B) {
+	const (
+		actorCount     = 500
+		slowCount      = 10
+		slowHandleTime = time.Millisecond
+	)
+	newActors := func(b *testing.B, fastWG *sync.WaitGroup) (map[string]Actor, []byte) {
+		// The slow actor stops being slow when done so backlog doesn't outlive
+		// the benchmark
+		done := make(chan struct{})
+		b.Cleanup(func() { close(done) })
+		actors := map[string]Actor{"slow": &testActor{fn: func(*actorMessage) {
+			select {
+			case <-done:
+			case <-time.After(slowHandleTime):
+			}
+		}}}
+		var packets []interface{}
+		for i := 0; i < slowCount; i++ {
+			packets = append(packets, map[string]interface{}{"from": "slow", "type": "event"})
+		}
+		for i := 0; i < actorCount; i++ {
+			id := fmt.Sprintf("actor%v", i)
+			actors[id] = &testActor{fn: func(*actorMessage) { fastWG.Done() }}
+			packets = append(packets, map[string]interface{}{"from": id, "type": "event"})
+		}
+		return actors, framePackets(b, packets...)
+	}
+	run := func(b *testing.B, conn net.Conn, batch []byte, fastWG *sync.WaitGroup) {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			fastWG.Add(actorCount)
+			if _, err := conn.Write(batch); err != nil {
+				b.Fatal(err)
+			}
+			fastWG.Wait()
+		}
+	}
+	b.Run("mailboxes", func(b *testing.B) {
+		f, s := newTestFirefox(b)
+		var fastWG sync.WaitGroup
+		actors, batch := newActors(b, &fastWG)
+		for id, actor := range actors {
+			f.mgr.setActor(id, actor)
+		}
+		run(b, s.conn, batch, &fastWG)
+	})
+	b.Run("serial", func(b *testing.B) {
+		f, conn := newTestRemote(b)
+		var fastWG sync.WaitGroup
+		actors, batch := newActors(b, &fastWG)
+		go func() {
+			for {
+				var msg actorMessage
+				if err := f.remote.recv(&msg); err != nil {
+					return
+				}
+				actors[msg.From].onMessage(&msg)
+			}
+		}()
+		run(b, conn, batch, &fastWG)
+	})
+}
@@ -1,39 +1,151 @@
 package firefox
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+)
 
+// Known fields are decoded as available. Fields whose shape doesn't match in
+// a packet are left empty, the entire packet is always in raw.
 type actorMessage struct {
 	To   string `json:"to,omitempty"`
 	From string `json:"from,omitempty"`
 	Type string `json:"type,omitempty"`
 
-	Tabs    []*actorTab       `json:"tabs,omitempty"`
-	Frame   *actorFrame       `json:"frame,omitempty"`
-	Title   string            `json:"title,omitempty"`
-	URL     string            `json:"url,omitempty"`
-	State   string            `json:"state,omitempty"`
-	Favicon actorFaviconBytes `json:"favicon,omitempty"`
+	Tabs  []*actorTab `json:"tabs,omitempty"`
+	Frame *actorFrame `json:"frame,omitempty"`
+	Title string      `json:"title,omitempty"`
+	URL   string      `json:"url,omitempty"`
+	State string      `json:"state,omitempty"`
+	// Present but possibly null when the favicon is sent
+	Favicon json.RawMessage `json:"favicon,omitempty"`
+
+	Error   string          `json:"error,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Value   json.RawMessage `json:"value,omitempty"`
+
+	// Only set on the root hello
+	ApplicationType string                 `json:"applicationType,omitempty"`
+	Traits          map[string]interface{} `json:"traits,omitempty"`
+
+	DeviceActor string `json:"deviceActor,omitempty"`
+	Actor       string `json:"actor,omitempty"`
+
+	// Watcher resources
+	ResourceTypes []string          `json:"resourceTypes,omitempty"`
+	Resources     []json.RawMessage `json:"resources,omitempty"`
+	Array         json.RawMessage   `json:"array,omitempty"`
+
+	// Network event details
+	Headers     []NetworkHeader    `json:"headers,omitempty"`
+	HeadersSize int64              `json:"headersSize,omitempty"`
+	Timings     map[string]float64 `json:"timings,omitempty"`
+	Content     *actorContent      `json:"content,omitempty"`
+
+	// Long strings
+	Start     *int   `json:"start,omitempty"`
+	End       *int   `json:"end,omitempty"`
+	Substring string `json:"substring,omitempty"`
+
+	// DOM inspection. Node is an actor ID string on requests and a node form on
+	// replies.
+	Walker   *actorWalker    `json:"walker,omitempty"`
+	Node     json.RawMessage `json:"node,omitempty"`
+	Nodes    []*actorNode    `json:"nodes,omitempty"`
+	List     *actorNodeList  `json:"list,omitempty"`
+	Selector string          `json:"selector,omitempty"`
+
+	// Storage
+	Cookies        *actorStore     `json:"cookies,omitempty"`
+	LocalStorage   *actorStore     `json:"localStorage,omitempty"`
+	SessionStorage *actorStore     `json:"sessionStorage,omitempty"`
+	IndexedDB      *actorStore     `json:"indexedDB,omitempty"`
+	Host           string          `json:"host,omitempty"`
+	Name           string          `json:"name,omitempty"`
+	GUID           string          `json:"guid,omitempty"`
+	Data           json.RawMessage `json:"data,omitempty"`
+
+	// Debugging
+	Options     map[string]interface{} `json:"options,omitempty"`
+	Location    *DebugLocation         `json:"location,omitempty"`
+	ResumeLimit map[string]interface{} `json:"resumeLimit,omitempty"`
+	Sources     []*actorSource         `json:"sources,omitempty"`
+	Source      *actorSource           `json:"source,omitempty"`
+	Frames      []*actorDebugFrame     `json:"frames,omitempty"`
+	Why         *actorWhy              `json:"why,omitempty"`
+	Bindings    *actorBindings         `json:"bindings,omitempty"`
+
+	// Generic request arguments
+	Args map[string]interface{} `json:"args,omitempty"`
+
+	// Evaluation. Result and exception are grips, the message is a string or
+	// long string grip. Exception is null when nothing was thrown, has
+	// exception is missing in older Firefox.
+	Text             string                 `json:"text,omitempty"`
+	Mapped           map[string]interface{} `json:"mapped,omitempty"`
+	ResultID         string                 `json:"resultID,omitempty"`
+	Result           json.RawMessage        `json:"result,omitempty"`
+	Exception        json.RawMessage        `json:"exception,omitempty"`
+	ExceptionMessage json.RawMessage        `json:"exceptionMessage,omitempty"`
+	HasException     *bool                  `json:"hasException,omitempty"`
+
+	// Only set on received messages
+	raw json.RawMessage
+}
+
+func (a *actorMessage) UnmarshalJSON(b []byte) error {
+	// Copy since the buffer is reused
+	a.raw = append(json.RawMessage(nil), b...)
+	// Type errors don't stop unmarshaling of other fields, so we can ignore them
+	type plainActorMessage actorMessage
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(b, (*plainActorMessage)(a)); err != nil && !errors.As(err, &typeErr) {
+		return err
+	}
+	return nil
 }
 
 type actorTab struct {
-	Actor    string `json:"actor,omitempty"`
-	Selected bool   `json:"selected,omitempty"`
-	Title    string `json:"title,omitempty"`
-	URL      string `json:"url,omitempty"`
+	Actor string `json:"actor,omitempty"`
+	// Newer Firefox identifies the tab's browser by browser ID, older by outer
+	// window ID
+	BrowserID     int    `json:"browserId,omitempty"`
+	OuterWindowID int    `json:"outerWindowID,omitempty"`
+	Selected      bool   `json:"selected,omitempty"`
+	Title         string `json:"title,omitempty"`
+	URL           string `json:"url,omitempty"`
 }
 
 type actorFrame struct {
-	Actor string `json:"actor,omitempty"`
-	Title string `json:"title,omitempty"`
-	URL   string `json:"url,omitempty"`
+	Actor           string `json:"actor,omitempty"`
+	Title           string `json:"title,omitempty"`
+	URL             string `json:"url,omitempty"`
+	ScreenshotActor string `json:"screenshotActor,omitempty"`
+	InspectorActor  string `json:"inspectorActor,omitempty"`
+	StorageActor    string `json:"storageActor,omitempty"`
+	ThreadActor     string `json:"threadActor,omitempty"`
+	ConsoleActor    string `json:"consoleActor,omitempty"`
 }
 
-type actorFaviconBytes struct {
-	set   bool
-	bytes []uint8
+type actorWalker struct {
+	Actor string     `json:"actor,omitempty"`
+	Root  *actorNode `json:"root,omitempty"`
 }
 
-func (a *actorFaviconBytes) UnmarshalJSON(data []byte) error {
-	a.set = true
-	return json.Unmarshal(data, &a.bytes)
+type actorContent struct {
+	MimeType string `json:"mimeType,omitempty"`
+	// String or long string grip
+	Text     json.RawMessage `json:"text,omitempty"`
+	Encoding string          `json:"encoding,omitempty"`
+}
+
+type actorLongString struct {
+	Type    string `json:"type,omitempty"`
+	Actor   string `json:"actor,omitempty"`
+	Length  int    `json:"length,omitempty"`
+	Initial string `json:"initial,omitempty"`
+}
+
+type actorWhy struct {
+	Type string `json:"type,omitempty"`
 }
@@ -0,0 +1,124 @@
+package firefox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// JS for the browser window's gBrowser
+const chromeGBrowserJS = `Services.wm.getMostRecentWindow("navigator:browser").gBrowser`
+
+// NewTab opens a tab at the end with the URL, selecting it if selected is
+// true. The tab appears in Tabs once Firefox reports the tab list change.
+func (f *Firefox) NewTab(ctx context.Context, url string, selected bool) error {
+	return f.openTab(ctx, url, 0, selected)
+}
+
+// Container ID 0 is no container
+func (f *Firefox) openTab(ctx context.Context, url string, containerID int, selected bool) error {
+	urlJSON, err := json.Marshal(url)
+	if err != nil {
+		return err
+	}
+	js := fmt.Sprintf(`(() => {
+  const gBrowser = %v;
+  const tab = gBrowser.addTrustedTab(%s, { userContextId: %d });
+  if (%v) gBrowser.selectedTab = tab;
+})()`, chromeGBrowserJS, urlJSON, containerID, selected)
+	if _, err := f.EvaluateChrome(ctx, js); err != nil {
+		return fmt.Errorf("failed opening tab: %w", err)
+	}
+	return nil
+}
+
+// SelectTabIndex selects the tab at the index in Tabs
+func (f *Firefox) SelectTabIndex(ctx context.Context, index int) error {
+	js := fmt.Sprintf(`(() => {
+  const gBrowser = %v;
+  if (%d >= gBrowser.tabs.length) throw new Error("no tab at index %d");
+  gBrowser.selectedTab = gBrowser.tabs[%d];
+})()`, chromeGBrowserJS, index, index, index)
+	if _, err := f.EvaluateChrome(ctx, js); err != nil {
+		return fmt.Errorf("failed selecting tab: %w", err)
+	}
+	// Selection isn't a tab list change, so re-list to update it
+	return f.send(&actorMessage{To: "root", Type: "listTabs"})
+}
+
+// ResetTabs replaces every tab with one new selected tab at the URL. Unlike
+// navigating, this leaves no session history to go back to. Closed tabs don't
+// prompt before unloading.
+func (f *Firefox) ResetTabs(ctx context.Context, url string) error {
+	urlJSON, err := json.Marshal(url)
+	if err != nil {
+		return err
+	}
+	js := fmt.Sprintf(`(() => {
+  const gBrowser = %v;
+  const oldTabs = Array.from(gBrowser.tabs);
+  gBrowser.selectedTab = gBrowser.addTrustedTab(%s);
+  for (const tab of oldTabs) gBrowser.removeTab(tab, { animate: false, skipPermitUnload: true });
+})()`, chromeGBrowserJS, urlJSON)
+	if _, err := f.EvaluateChrome(ctx, js); err != nil {
+		return fmt.Errorf("failed resetting tabs: %w", err)
+	}
+	return nil
+}
+
+// ClearDataKind is a set of kinds of data for ClearData
+type ClearDataKind int
+
+const (
+	// Also HTTP authentication
+	ClearCookies ClearDataKind = 1 << iota
+	// E.g. local storage, IndexedDB, and service workers
+	ClearStorage
+	ClearCache
+	// Also session history and downloads
+	ClearHistory
+	ClearFormData
+
+	// What a shared browser clears between users. Permissions, certificate
+	// exceptions, and the like are kept.
+	ClearBrowsingData = ClearCookies | ClearStorage | ClearCache | ClearHistory | ClearFormData
+)
+
+// nsIClearDataService flags for each kind
+var clearDataFlagNames = map[ClearDataKind][]string{
+	ClearCookies:  {"CLEAR_COOKIES", "CLEAR_AUTH_CACHE"},
+	ClearStorage:  {"CLEAR_DOM_STORAGES"},
+	ClearCache:    {"CLEAR_ALL_CACHES"},
+	ClearHistory:  {"CLEAR_HISTORY", "CLEAR_SESSION_HISTORY", "CLEAR_DOWNLOADS"},
+	ClearFormData: {"CLEAR_FORMDATA"},
+}
+
+// ClearData clears the given kinds of data in the profile. Prefs are kept.
+func (f *Firefox) ClearData(ctx context.Context, kinds ClearDataKind) error {
+	var names []string
+	for kind, kindNames := range clearDataFlagNames {
+		if kinds&kind != 0 {
+			names = append(names, kindNames...)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	namesJSON, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	// Flags missing in this version are skipped
+	js := fmt.Sprintf(`new Promise((resolve, reject) => {
+  const flags = %s.reduce((flags, name) => flags | (Ci.nsIClearDataService[name] || 0), 0);
+  Services.clearData.deleteData(flags, {
+    onDataDeleted: failedFlags => failedFlags ? reject(new Error("failed clearing flags " + failedFlags)) : resolve()
+  });
+})`, namesJSON)
+	if _, err := f.EvaluateChrome(ctx, js); err != nil {
+		return fmt.Errorf("failed clearing data: %w", err)
+	}
+	return nil
+}
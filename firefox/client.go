@@ -0,0 +1,58 @@
+package firefox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Client is a low-level client for sending packets to any actor, for use with
+// actors or packet types not otherwise supported.
+type Client struct {
+	mgr *actorManager
+}
+
+// Send sends the packet to the actor and returns the reply packet. The "to"
+// field of the packet is set to the actor. An error reply is returned as
+// *ActorError. Replies are any packet from the actor without a type (or with
+// an error) in the order requests were sent. For actors whose replies have a
+// type, use SendAnyType.
+func (c *Client) Send(ctx context.Context, to string, packet map[string]interface{}) (json.RawMessage, error) {
+	return c.send(ctx, to, packet, false)
+}
+
+// SendAnyType is the same as Send except the next packet from the actor is
+// considered the reply even if it has a type. This should only be used for
+// actors that don't send events.
+func (c *Client) SendAnyType(ctx context.Context, to string, packet map[string]interface{}) (json.RawMessage, error) {
+	return c.send(ctx, to, packet, true)
+}
+
+func (c *Client) send(ctx context.Context, to string, packet map[string]interface{}, anyType bool) (json.RawMessage, error) {
+	if to == "" {
+		return nil, fmt.Errorf("missing actor")
+	}
+	// Copy so we can set "to"
+	toSend := make(map[string]interface{}, len(packet)+1)
+	for k, v := range packet {
+		toSend[k] = v
+	}
+	toSend["to"] = to
+	reply, err := c.mgr.requestPacket(ctx, to, toSend, anyType)
+	if err != nil {
+		return nil, err
+	}
+	return reply.raw, nil
+}
+
+// Subscribe sends every non-reply packet from the actor with the given type to
+// the returned channel. An empty type means all types. Packets are dropped if
+// the channel is not read fast enough. Use Unsubscribe when done.
+func (c *Client) Subscribe(actor, typ string) <-chan json.RawMessage {
+	return c.mgr.subscribe(actor, typ)
+}
+
+// Unsubscribe stops and closes a channel from Subscribe
+func (c *Client) Unsubscribe(ch <-chan json.RawMessage) {
+	c.mgr.unsubscribe(ch)
+}
@@ -0,0 +1,236 @@
+package firefox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConsoleMessage is a console API call or page error
+type ConsoleMessage struct {
+	// E.g. "log", "info", "warn", "error", or "debug". Page errors are "error"
+	// or "warn".
+	Level string
+	Text  string
+	// True if this is an uncaught error or other page error instead of a
+	// console API call
+	PageError bool
+	SourceURL string
+	Line      int
+	Column    int
+	Time      time.Time
+	// Innermost first, may be empty
+	Stack []ConsoleStackFrame
+}
+
+type ConsoleStackFrame struct {
+	FunctionName string `json:"functionName"`
+	SourceURL    string `json:"filename"`
+	Line         int    `json:"lineNumber"`
+	Column       int    `json:"columnNumber"`
+}
+
+// ConsoleMessages starts watching console messages and page errors if not
+// already started and sends them to the returned channel until the context is
+// done at which point the channel is closed. Messages are dropped if the
+// channel is not read fast enough.
+func (t *TabActor) ConsoleMessages(ctx context.Context) (<-chan ConsoleMessage, error) {
+	m, err := t.getConsoleMonitor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan ConsoleMessage, 100)
+	m.subsLock.Lock()
+	m.subs[ch] = struct{}{}
+	m.subsLock.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.subsLock.Lock()
+		defer m.subsLock.Unlock()
+		delete(m.subs, ch)
+		close(ch)
+	}()
+	return ch, nil
+}
+
+type consoleMonitor struct {
+	tab      *TabActor
+	subs     map[chan<- ConsoleMessage]struct{}
+	subsLock sync.RWMutex
+}
+
+func (t *TabActor) getConsoleMonitor(ctx context.Context) (*consoleMonitor, error) {
+	t.consoleLock.Lock()
+	defer t.consoleLock.Unlock()
+	if t.console != nil {
+		return t.console, nil
+	}
+	w, err := t.getWatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := &consoleMonitor{tab: t, subs: map[chan<- ConsoleMessage]struct{}{}}
+	if err := w.watchResource(ctx, "console-message", m.onResource); err != nil {
+		return nil, err
+	} else if err := w.watchResource(ctx, "error-message", m.onResource); err != nil {
+		return nil, err
+	}
+	t.console = m
+	return m, nil
+}
+
+// Logs every console message of the tab until the tab is closed
+func (t *TabActor) logConsoleMessages() {
+	f := t.root.mgr.firefox
+	msgs, err := t.ConsoleMessages(t.ctx)
+	if err != nil {
+		// Not worth logging if the tab closed first
+		if t.ctx.Err() == nil {
+			f.log.Errorf("Failed watching console messages for %v: %v", t.ID, err)
+		}
+		return
+	}
+	for msg := range msgs {
+		switch msg.Level {
+		case "error", "assert":
+			f.log.Errorf("Console %v at %v:%v: %v", msg.Level, msg.SourceURL, msg.Line, msg.Text)
+		case "debug", "trace":
+			f.log.Debugf("Console %v at %v:%v: %v", msg.Level, msg.SourceURL, msg.Line, msg.Text)
+		default:
+			f.log.Infof("Console %v at %v:%v: %v", msg.Level, msg.SourceURL, msg.Line, msg.Text)
+		}
+	}
+}
+
+type actorConsoleMessage struct {
+	// Older Firefox nests the message in this field
+	Message      *actorConsoleMessage `json:"message"`
+	Arguments    []json.RawMessage    `json:"arguments"`
+	Level        string               `json:"level"`
+	Filename     string               `json:"filename"`
+	LineNumber   int                  `json:"lineNumber"`
+	ColumnNumber int                  `json:"columnNumber"`
+	TimeStamp    float64              `json:"timeStamp"`
+	Stacktrace   []ConsoleStackFrame  `json:"stacktrace"`
+}
+
+type actorPageError struct {
+	PageError    *actorPageError     `json:"pageError"`
+	ErrorMessage json.RawMessage     `json:"errorMessage"`
+	SourceName   string              `json:"sourceName"`
+	LineNumber   int                 `json:"lineNumber"`
+	ColumnNumber int                 `json:"columnNumber"`
+	TimeStamp    float64             `json:"timeStamp"`
+	Warning      bool                `json:"warning"`
+	Stacktrace   []ConsoleStackFrame `json:"stacktrace"`
+}
+
+// Called on the actor dispatch goroutine
+func (c *consoleMonitor) onResource(res *actorResource, updated bool) {
+	if updated {
+		return
+	}
+	var msg ConsoleMessage
+	if res.ResourceType == "console-message" {
+		var m actorConsoleMessage
+		if err := json.Unmarshal(res.raw, &m); err != nil {
+			c.tab.root.mgr.firefox.log.Errorf("Invalid console message: %v", err)
+			return
+		} else if m.Message != nil {
+			m = *m.Message
+		}
+		args := make([]string, len(m.Arguments))
+		for i, arg := range m.Arguments {
+			args[i] = gripText(arg)
+		}
+		msg = ConsoleMessage{
+			Level:     m.Level,
+			Text:      strings.Join(args, " "),
+			SourceURL: m.Filename,
+			Line:      m.LineNumber,
+			Column:    m.ColumnNumber,
+			Time:      msTime(m.TimeStamp),
+			Stack:     m.Stacktrace,
+		}
+	} else {
+		var e actorPageError
+		if err := json.Unmarshal(res.raw, &e); err != nil {
+			c.tab.root.mgr.firefox.log.Errorf("Invalid page error: %v", err)
+			return
+		} else if e.PageError != nil {
+			e = *e.PageError
+		}
+		msg = ConsoleMessage{
+			Level:     "error",
+			Text:      gripText(e.ErrorMessage),
+			PageError: true,
+			SourceURL: e.SourceName,
+			Line:      e.LineNumber,
+			Column:    e.ColumnNumber,
+			Time:      msTime(e.TimeStamp),
+			Stack:     e.Stacktrace,
+		}
+		if e.Warning {
+			msg.Level = "warn"
+		}
+	}
+	c.subsLock.RLock()
+	defer c.subsLock.RUnlock()
+	for ch := range c.subs {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+func msTime(ms float64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ms*float64(time.Millisecond)))
+}
+
+// Best-effort text of a value grip without making requests
+func gripText(v json.RawMessage) string {
+	if len(v) == 0 {
+		return ""
+	}
+	var grip struct {
+		Type    string `json:"type"`
+		Class   string `json:"class"`
+		Initial string `json:"initial"`
+		Name    string `json:"name"`
+		Text    string `json:"text"`
+	}
+	switch v[0] {
+	case '"':
+		var str string
+		json.Unmarshal(v, &str)
+		return str
+	case '{':
+		if err := json.Unmarshal(v, &grip); err != nil {
+			return string(v)
+		}
+	default:
+		// Numbers and bools
+		return string(v)
+	}
+	switch grip.Type {
+	case "undefined", "null", "NaN", "Infinity", "-Infinity", "-0":
+		return grip.Type
+	case "longString":
+		return grip.Initial + "…"
+	case "symbol":
+		return fmt.Sprintf("Symbol(%v)", grip.Name)
+	case "BigInt":
+		return grip.Text + "n"
+	case "object":
+		return fmt.Sprintf("[object %v]", grip.Class)
+	default:
+		return string(v)
+	}
+}
@@ -0,0 +1,92 @@
+package firefox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Container is a contextual identity. Tabs in a container have their own
+// cookies and storage, isolated from other containers and from tabs in none.
+type Container struct {
+	ID    int    `json:"userContextId"`
+	Name  string `json:"name"`
+	Icon  string `json:"icon"`
+	Color string `json:"color"`
+}
+
+// Defaults for CreateContainer
+const (
+	DefaultContainerIcon  = "circle"
+	DefaultContainerColor = "blue"
+)
+
+const contextualIdentityImportJS = `const { ContextualIdentityService } = ChromeUtils.import("resource://gre/modules/ContextualIdentityService.jsm");`
+
+// Containers lists the containers, including Firefox's default ones. This
+// requires Config.Containers.
+func (f *Firefox) Containers(ctx context.Context) ([]*Container, error) {
+	js := `(() => {
+  ` + contextualIdentityImportJS + `
+  // Default identities only have localization IDs, so use the label
+  return JSON.stringify(ContextualIdentityService.getPublicIdentities().map(identity => ({
+    userContextId: identity.userContextId,
+    name: ContextualIdentityService.getUserContextLabel(identity.userContextId),
+    icon: identity.icon,
+    color: identity.color
+  })));
+})()`
+	var containers []*Container
+	if err := f.EvaluateChromeJSON(ctx, js, &containers); err != nil {
+		return nil, fmt.Errorf("failed listing containers: %w", err)
+	}
+	return containers, nil
+}
+
+// CreateContainer creates a container. Icon and color are Firefox's names,
+// e.g. "briefcase" or "red". Empty values use DefaultContainerIcon and
+// DefaultContainerColor.
+func (f *Firefox) CreateContainer(ctx context.Context, name, icon, color string) (*Container, error) {
+	if icon == "" {
+		icon = DefaultContainerIcon
+	}
+	if color == "" {
+		color = DefaultContainerColor
+	}
+	args, err := json.Marshal([]string{name, icon, color})
+	if err != nil {
+		return nil, err
+	}
+	js := fmt.Sprintf(`(() => {
+  %v
+  const identity = ContextualIdentityService.create(...%s);
+  return JSON.stringify({ userContextId: identity.userContextId, name: identity.name, icon: identity.icon, color: identity.color });
+})()`, contextualIdentityImportJS, args)
+	var container Container
+	if err := f.EvaluateChromeJSON(ctx, js, &container); err != nil {
+		return nil, fmt.Errorf("failed creating container: %w", err)
+	}
+	return &container, nil
+}
+
+// RemoveContainer closes the container's tabs, clears its data, and removes
+// it
+func (f *Firefox) RemoveContainer(ctx context.Context, id int) error {
+	js := fmt.Sprintf(`(async () => {
+  %v
+  ContextualIdentityService.closeContainerTabs(%d);
+  await new Promise(resolve => Services.clearData.deleteDataFromOriginAttributesPattern(
+    { userContextId: %d }, { onDataDeleted: () => resolve() }));
+  if (!ContextualIdentityService.remove(%d)) throw new Error("no container %d");
+})()`, contextualIdentityImportJS, id, id, id, id)
+	if _, err := f.EvaluateChrome(ctx, js); err != nil {
+		return fmt.Errorf("failed removing container: %w", err)
+	}
+	return nil
+}
+
+// NewContainerTab is NewTab with the tab in the container. This requires
+// Config.Containers.
+func (f *Firefox) NewContainerTab(ctx context.Context, url string, containerID int, selected bool) error {
+	return f.openTab(ctx, url, containerID, selected)
+}
@@ -0,0 +1,299 @@
+package firefox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Debugger is a script debugger client for a tab's current target. It is no
+// longer valid once the tab navigates to a new target.
+type Debugger struct {
+	tab    *TabActor
+	thread string
+
+	pausedCh chan *DebugPause
+	// Drained by run
+	eventCh   chan *actorMessage
+	runCancel context.CancelFunc
+
+	// Keyed by source actor ID
+	sources     map[string]*DebugSource
+	sourcesLock sync.RWMutex
+}
+
+type DebugSource struct {
+	URL              string
+	IsBlackBoxed     bool
+	SourceMapURL     string
+	IntroductionType string
+
+	actor string
+}
+
+type DebugPause struct {
+	// E.g. "breakpoint", "resumeLimit", "debuggerStatement", "exception", or
+	// "interrupted"
+	Reason string
+	// Innermost first
+	Frames []*DebugFrame
+	// Bindings of the innermost frame's environment including arguments,
+	// values are rendered as text
+	Variables map[string]string
+}
+
+type DebugFrame struct {
+	FunctionName string
+	SourceURL    string
+	Line         int
+	Column       int
+}
+
+type DebugLocation struct {
+	SourceURL string `json:"sourceUrl"`
+	Line      int    `json:"line"`
+	// Default is any column on the line
+	Column *int `json:"column,omitempty"`
+}
+
+type actorSource struct {
+	Actor            string `json:"actor"`
+	URL              string `json:"url"`
+	IsBlackBoxed     bool   `json:"isBlackBoxed"`
+	SourceMapURL     string `json:"sourceMapURL"`
+	IntroductionType string `json:"introductionType"`
+}
+
+type actorDebugFrame struct {
+	Actor       string `json:"actor"`
+	DisplayName string `json:"displayName"`
+	Where       struct {
+		Actor  string `json:"actor"`
+		Line   int    `json:"line"`
+		Column int    `json:"column"`
+	} `json:"where"`
+}
+
+type actorBindings struct {
+	// Each is a single-key object of name to descriptor
+	Arguments []map[string]actorBindingDescriptor `json:"arguments"`
+	Variables map[string]actorBindingDescriptor   `json:"variables"`
+}
+
+type actorBindingDescriptor struct {
+	Value json.RawMessage `json:"value"`
+}
+
+// AttachDebugger attaches to the thread of the tab's current target. Only one
+// debugger should be attached per target.
+func (t *TabActor) AttachDebugger(ctx context.Context) (*Debugger, error) {
+	t.fieldsLock.RLock()
+	thread := t.threadActor
+	t.fieldsLock.RUnlock()
+	if thread == "" {
+		return nil, fmt.Errorf("no thread actor for tab")
+	}
+	d := &Debugger{
+		tab:      t,
+		thread:   thread,
+		pausedCh: make(chan *DebugPause, 10),
+		eventCh:  make(chan *actorMessage, 100),
+		sources:  map[string]*DebugSource{},
+	}
+	t.root.mgr.setActor(thread, d)
+	// Older Firefox replies with a pause and leaves the thread paused
+	reply, err := d.requestReplyType(ctx, &actorMessage{Type: "attach", Options: map[string]interface{}{}}, "paused")
+	if err == nil && reply.Type == "paused" {
+		err = d.resume(ctx, "")
+	}
+	if err != nil {
+		t.root.mgr.removeActor(thread)
+		return nil, fmt.Errorf("failed attaching to thread: %w", err)
+	}
+	var runCtx context.Context
+	runCtx, d.runCancel = context.WithCancel(t.ctx)
+	go d.run(runCtx)
+	return d, nil
+}
+
+// Paused receives a value each time the thread pauses. If not read fast
+// enough, pauses are dropped.
+func (d *Debugger) Paused() <-chan *DebugPause { return d.pausedCh }
+
+// Sources lists all sources currently known to the thread
+func (d *Debugger) Sources(ctx context.Context) ([]*DebugSource, error) {
+	reply, err := d.request(ctx, &actorMessage{Type: "sources"})
+	if err != nil {
+		return nil, fmt.Errorf("failed listing sources: %w", err)
+	}
+	sources := make([]*DebugSource, len(reply.Sources))
+	for i, source := range reply.Sources {
+		sources[i] = d.addSource(source)
+	}
+	return sources, nil
+}
+
+// SetBreakpoint sets a breakpoint by URL and line. It applies to sources
+// loaded later too.
+func (d *Debugger) SetBreakpoint(ctx context.Context, loc DebugLocation) error {
+	_, err := d.request(ctx, &actorMessage{Type: "setBreakpoint", Location: &loc, Options: map[string]interface{}{}})
+	if err != nil {
+		return fmt.Errorf("failed setting breakpoint: %w", err)
+	}
+	return nil
+}
+
+func (d *Debugger) RemoveBreakpoint(ctx context.Context, loc DebugLocation) error {
+	if _, err := d.request(ctx, &actorMessage{Type: "removeBreakpoint", Location: &loc}); err != nil {
+		return fmt.Errorf("failed removing breakpoint: %w", err)
+	}
+	return nil
+}
+
+// Resume resumes a paused thread
+func (d *Debugger) Resume(ctx context.Context) error { return d.resume(ctx, "") }
+
+// StepOver resumes a paused thread until the next line
+func (d *Debugger) StepOver(ctx context.Context) error { return d.resume(ctx, "next") }
+
+// StepIn resumes a paused thread until the next line including into calls
+func (d *Debugger) StepIn(ctx context.Context) error { return d.resume(ctx, "step") }
+
+// StepOut resumes a paused thread until the current function returns
+func (d *Debugger) StepOut(ctx context.Context) error { return d.resume(ctx, "finish") }
+
+func (d *Debugger) resume(ctx context.Context, limit string) error {
+	msg := &actorMessage{Type: "resume"}
+	if limit != "" {
+		msg.ResumeLimit = map[string]interface{}{"type": limit}
+	}
+	if _, err := d.requestReplyType(ctx, msg, "resumed"); err != nil {
+		return fmt.Errorf("failed resuming: %w", err)
+	}
+	return nil
+}
+
+// Interrupt pauses a running thread
+func (d *Debugger) Interrupt(ctx context.Context) error {
+	reply, err := d.requestReplyType(ctx, &actorMessage{Type: "interrupt"}, "paused")
+	if err != nil {
+		return fmt.Errorf("failed interrupting: %w", err)
+	}
+	// Older Firefox replies with the pause instead of sending it after
+	if reply.Type == "paused" {
+		d.onMessage(reply)
+	}
+	return nil
+}
+
+// Detach detaches from the thread, resuming it if paused. The debugger cannot
+// be used after this.
+func (d *Debugger) Detach(ctx context.Context) error {
+	defer d.runCancel()
+	defer d.tab.root.mgr.removeActor(d.thread)
+	if _, err := d.request(ctx, &actorMessage{Type: "detach"}); err != nil {
+		return fmt.Errorf("failed detaching: %w", err)
+	}
+	return nil
+}
+
+func (d *Debugger) request(ctx context.Context, msg *actorMessage) (*actorMessage, error) {
+	msg.To = d.thread
+	return d.tab.root.mgr.request(ctx, msg)
+}
+
+func (d *Debugger) requestReplyType(ctx context.Context, msg *actorMessage, replyType string) (*actorMessage, error) {
+	msg.To = d.thread
+	return d.tab.root.mgr.requestReplyType(ctx, msg, replyType)
+}
+
+func (d *Debugger) addSource(source *actorSource) *DebugSource {
+	d.sourcesLock.Lock()
+	defer d.sourcesLock.Unlock()
+	s := &DebugSource{
+		URL:              source.URL,
+		IsBlackBoxed:     source.IsBlackBoxed,
+		SourceMapURL:     source.SourceMapURL,
+		IntroductionType: source.IntroductionType,
+		actor:            source.Actor,
+	}
+	d.sources[source.Actor] = s
+	return s
+}
+
+// Called on the actor dispatch goroutine
+func (d *Debugger) onMessage(msg *actorMessage) {
+	switch msg.Type {
+	case "newSource":
+		if msg.Source != nil {
+			d.addSource(msg.Source)
+		}
+	case "paused":
+		// Needs requests to build, so do it elsewhere
+		select {
+		case d.eventCh <- msg:
+		default:
+			d.tab.root.mgr.firefox.log.Errorf("Dropping pause event for %v", d.thread)
+		}
+	}
+}
+
+func (d *Debugger) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-d.eventCh:
+			pause, err := d.buildPause(ctx, msg)
+			if err != nil {
+				d.tab.root.mgr.firefox.log.Errorf("Failed building pause for %v: %v", d.thread, err)
+				continue
+			}
+			select {
+			case d.pausedCh <- pause:
+			default:
+			}
+		}
+	}
+}
+
+func (d *Debugger) buildPause(ctx context.Context, msg *actorMessage) (*DebugPause, error) {
+	pause := &DebugPause{Variables: map[string]string{}}
+	if msg.Why != nil {
+		pause.Reason = msg.Why.Type
+	}
+	// Get all frames
+	start := 0
+	reply, err := d.request(ctx, &actorMessage{Type: "frames", Start: &start})
+	if err != nil {
+		return nil, fmt.Errorf("failed getting frames: %w", err)
+	}
+	for _, frame := range reply.Frames {
+		f := &DebugFrame{FunctionName: frame.DisplayName, Line: frame.Where.Line, Column: frame.Where.Column}
+		d.sourcesLock.RLock()
+		if source := d.sources[frame.Where.Actor]; source != nil {
+			f.SourceURL = source.URL
+		}
+		d.sourcesLock.RUnlock()
+		pause.Frames = append(pause.Frames, f)
+	}
+	// Get environment of top frame. The reply has the environment type as its
+	// type field.
+	if len(reply.Frames) > 0 {
+		env, err := d.tab.root.mgr.requestAnyType(ctx, &actorMessage{To: reply.Frames[0].Actor, Type: "getEnvironment"})
+		if err != nil {
+			return nil, fmt.Errorf("failed getting environment: %w", err)
+		} else if env.Bindings != nil {
+			for _, arg := range env.Bindings.Arguments {
+				for name, desc := range arg {
+					pause.Variables[name] = gripText(desc.Value)
+				}
+			}
+			for name, desc := range env.Bindings.Variables {
+				pause.Variables[name] = gripText(desc.Value)
+			}
+		}
+	}
+	return pause, nil
+}
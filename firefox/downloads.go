@@ -0,0 +1,251 @@
+package firefox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type DownloadEventType int
+
+const (
+	DownloadStarted DownloadEventType = iota
+	DownloadProgress
+	DownloadCompleted
+	// Includes canceled downloads
+	DownloadFailed
+)
+
+func (d DownloadEventType) String() string {
+	switch d {
+	case DownloadStarted:
+		return "started"
+	case DownloadProgress:
+		return "progress"
+	case DownloadCompleted:
+		return "completed"
+	case DownloadFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("unknown download event %d", int(d))
+	}
+}
+
+// Download is the state of a download as of an event
+type Download struct {
+	// Unique for the life of the Firefox process
+	ID  int
+	URL string
+	// Target file path. It's only complete once the download has completed.
+	Path         string
+	Started      time.Time
+	CurrentBytes int64
+	// -1 if unknown
+	TotalBytes int64
+	Canceled   bool
+	// Set on failure, "canceled" if canceled without another error
+	Error string
+}
+
+type DownloadEvent struct {
+	Type DownloadEventType
+	Download
+}
+
+// How long each poll waits in Firefox for a change
+const downloadPollWait = 20 * time.Second
+
+// Adds a view to the download list once per window that queues changes, then
+// waits for changes and returns them as JSON. Repeated changes to a download
+// before the poll are merged.
+const downloadPollJSON = `(async () => {
+  const win = Services.wm.getMostRecentWindow("navigator:browser");
+  let state = win.__ffembedDownloads;
+  if (!state) {
+    const { Downloads } = ChromeUtils.import("resource://gre/modules/Downloads.jsm");
+    state = win.__ffembedDownloads = { ids: new WeakMap(), nextID: 1, pending: new Map(), wake: null };
+    const queue = d => {
+      let id = state.ids.get(d);
+      if (!id) {
+        id = state.nextID++;
+        state.ids.set(d, id);
+      }
+      state.pending.set(id, {
+        id,
+        url: d.source.url,
+        path: d.target.path,
+        startTime: d.startTime ? d.startTime.getTime() : 0,
+        currentBytes: d.currentBytes,
+        totalBytes: d.hasProgress ? d.totalBytes : -1,
+        succeeded: d.succeeded,
+        stopped: d.stopped,
+        canceled: d.canceled,
+        error: d.error ? (d.error.message || String(d.error)) : ""
+      });
+      if (state.wake) {
+        state.wake();
+        state.wake = null;
+      }
+    };
+    const list = await Downloads.getList(Downloads.ALL);
+    await list.addView({ onDownloadAdded: queue, onDownloadChanged: queue });
+  }
+  if (!state.pending.size) {
+    await new Promise(resolve => {
+      state.wake = resolve;
+      win.setTimeout(resolve, %d);
+    });
+  }
+  const downloads = Array.from(state.pending.values());
+  state.pending.clear();
+  return JSON.stringify(downloads);
+})()`
+
+type jsDownload struct {
+	ID           int    `json:"id"`
+	URL          string `json:"url"`
+	Path         string `json:"path"`
+	StartTime    int64  `json:"startTime"`
+	CurrentBytes int64  `json:"currentBytes"`
+	TotalBytes   int64  `json:"totalBytes"`
+	Succeeded    bool   `json:"succeeded"`
+	// Also set when paused
+	Stopped  bool   `json:"stopped"`
+	Canceled bool   `json:"canceled"`
+	Error    string `json:"error"`
+}
+
+// WatchDownloads starts watching downloads if not already started and sends
+// events to the returned channel until the context is done at which point the
+// channel is closed. Downloads already in the list when first started are
+// reported as started. Progress events are merged between polls so not every
+// change is seen. Events are dropped for readers that fall behind. This uses
+// chrome evaluation, see EvaluateChrome.
+func (f *Firefox) WatchDownloads(ctx context.Context) (<-chan DownloadEvent, error) {
+	m, err := f.getDownloadMonitor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan DownloadEvent, 100)
+	m.subsLock.Lock()
+	m.subs[ch] = struct{}{}
+	m.subsLock.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.subsLock.Lock()
+		defer m.subsLock.Unlock()
+		delete(m.subs, ch)
+		close(ch)
+	}()
+	return ch, nil
+}
+
+type downloadMonitor struct {
+	firefox *Firefox
+	subs    map[chan<- DownloadEvent]struct{}
+	// Last event type by ID, only accessed on the run goroutine
+	lastTypes map[int]DownloadEventType
+	subsLock  sync.RWMutex
+}
+
+func (f *Firefox) getDownloadMonitor(ctx context.Context) (*downloadMonitor, error) {
+	f.downloadsLock.Lock()
+	defer f.downloadsLock.Unlock()
+	if f.downloads != nil {
+		return f.downloads, nil
+	}
+	// Fail early if chrome evaluation isn't available
+	if _, err := f.getChromeConsoleActor(ctx); err != nil {
+		return nil, err
+	}
+	m := &downloadMonitor{
+		firefox:   f,
+		subs:      map[chan<- DownloadEvent]struct{}{},
+		lastTypes: map[int]DownloadEventType{},
+	}
+	go m.run(f.runCtx)
+	f.downloads = m
+	return m, nil
+}
+
+func (d *downloadMonitor) run(ctx context.Context) {
+	js := fmt.Sprintf(downloadPollJSON, downloadPollWait.Milliseconds())
+	for ctx.Err() == nil {
+		var downloads []*jsDownload
+		pollCtx, cancel := context.WithTimeout(ctx, downloadPollWait+10*time.Second)
+		err := d.firefox.EvaluateChromeJSON(pollCtx, js, &downloads)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				d.firefox.log.Errorf("Failed polling downloads: %v", err)
+				// Don't spin on a persistent failure
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+			continue
+		}
+		for _, download := range downloads {
+			for _, ev := range d.events(download) {
+				d.broadcast(ev)
+			}
+		}
+	}
+}
+
+// Events for a changed download, empty if it's a repeat of a completion or
+// failure
+func (d *downloadMonitor) events(js *jsDownload) []DownloadEvent {
+	ev := DownloadEvent{Download: Download{
+		ID:           js.ID,
+		URL:          js.URL,
+		Path:         js.Path,
+		CurrentBytes: js.CurrentBytes,
+		TotalBytes:   js.TotalBytes,
+		Canceled:     js.Canceled,
+		Error:        js.Error,
+	}}
+	if js.StartTime > 0 {
+		ev.Started = time.Unix(0, js.StartTime*int64(time.Millisecond))
+	}
+	last, seen := d.lastTypes[js.ID]
+	done := seen && (last == DownloadCompleted || last == DownloadFailed)
+	switch {
+	case js.Succeeded:
+		ev.Type = DownloadCompleted
+	case js.Stopped && (js.Canceled || js.Error != ""):
+		ev.Type = DownloadFailed
+		if ev.Error == "" {
+			ev.Error = "canceled"
+		}
+	// Restarted after completion or failure counts as started again
+	case !seen || done:
+		ev.Type = DownloadStarted
+	default:
+		ev.Type = DownloadProgress
+	}
+	if done && ev.Type == last {
+		return nil
+	}
+	d.lastTypes[js.ID] = ev.Type
+	// Always report started first
+	if !seen && ev.Type != DownloadStarted {
+		started := ev
+		started.Type = DownloadStarted
+		return []DownloadEvent{started, ev}
+	}
+	return []DownloadEvent{ev}
+}
+
+func (d *downloadMonitor) broadcast(ev DownloadEvent) {
+	d.subsLock.RLock()
+	defer d.subsLock.RUnlock()
+	for ch := range d.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package firefox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// EvalError is returned when evaluated JS throws
+type EvalError struct {
+	Message string
+	// Grip of the thrown value
+	Exception json.RawMessage
+}
+
+func (e *EvalError) Error() string {
+	return "evaluation failed: " + e.Message
+}
+
+// Evaluate runs the JS in the tab's page and returns the result as a value
+// grip. A thrown exception is returned as *EvalError. A returned promise is
+// awaited if Firefox supports it.
+func (t *TabActor) Evaluate(ctx context.Context, js string) (json.RawMessage, error) {
+	t.fieldsLock.RLock()
+	consoleActor := t.consoleActor
+	t.fieldsLock.RUnlock()
+	if consoleActor == "" {
+		return nil, fmt.Errorf("tab has no console actor")
+	}
+	return t.root.mgr.evaluate(ctx, consoleActor, js)
+}
+
+// EvaluateChrome runs the JS with chrome privileges in the parent process, e.g.
+// to use Services or other browser internals. Otherwise the same as
+// TabActor.Evaluate. This requires the devtools.chrome.enabled pref, which
+// the default profile sets.
+func (f *Firefox) EvaluateChrome(ctx context.Context, js string) (json.RawMessage, error) {
+	consoleActor, err := f.getChromeConsoleActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return f.mgr.evaluate(ctx, consoleActor, js)
+}
+
+// EvaluateChromeJSON runs JS with EvaluateChrome that results in a JSON string
+// (or a promise of one) and unmarshals it into v
+func (f *Firefox) EvaluateChromeJSON(ctx context.Context, js string, v interface{}) error {
+	result, err := f.EvaluateChrome(ctx, js)
+	if err != nil {
+		return err
+	}
+	str, err := f.mgr.resolveString(ctx, result)
+	if err != nil {
+		return fmt.Errorf("expected JSON string result, got %s: %w", result, err)
+	} else if err = json.Unmarshal([]byte(str), v); err != nil {
+		return fmt.Errorf("failed unmarshaling result: %w", err)
+	}
+	return nil
+}
+
+func (f *Firefox) getChromeConsoleActor(ctx context.Context) (string, error) {
+	f.chromeConsoleLock.Lock()
+	defer f.chromeConsoleLock.Unlock()
+	if f.chromeConsoleActor != "" {
+		return f.chromeConsoleActor, nil
+	}
+	// Process 0 is the parent
+	packet := map[string]interface{}{"to": "root", "type": "getProcess", "id": 0}
+	reply, err := f.mgr.requestPacket(ctx, "root", packet, false)
+	if err != nil {
+		return "", fmt.Errorf("failed getting parent process: %w", err)
+	}
+	// Newer Firefox returns a descriptor to get the target from, older returns
+	// the target form
+	var process struct {
+		ProcessDescriptor *actorFrame `json:"processDescriptor"`
+		Form              *actorFrame `json:"form"`
+		Process           *actorFrame `json:"process"`
+	}
+	if err := json.Unmarshal(reply.raw, &process); err != nil {
+		return "", fmt.Errorf("invalid process reply: %w", err)
+	}
+	if process.ProcessDescriptor != nil {
+		reply, err := f.mgr.request(ctx, &actorMessage{To: process.ProcessDescriptor.Actor, Type: "getTarget"})
+		if err != nil {
+			return "", fmt.Errorf("failed getting parent process target: %w", err)
+		} else if err = json.Unmarshal(reply.raw, &process); err != nil {
+			return "", fmt.Errorf("invalid process target reply: %w", err)
+		}
+	}
+	for _, form := range []*actorFrame{process.Process, process.Form} {
+		if form != nil && form.ConsoleActor != "" {
+			f.chromeConsoleActor = form.ConsoleActor
+			return f.chromeConsoleActor, nil
+		}
+	}
+	return "", fmt.Errorf("parent process has no console actor")
+}
+
+// Evaluates with the given console actor. The reply only has the result ID,
+// the result comes later as an event.
+func (a *actorManager) evaluate(ctx context.Context, consoleActor string, js string) (json.RawMessage, error) {
+	// Subscribe before sending so the result isn't missed
+	results := a.subscribe(consoleActor, "evaluationResult")
+	defer a.unsubscribe(results)
+	reply, err := a.request(ctx, &actorMessage{
+		To:   consoleActor,
+		Type: "evaluateJSAsync",
+		Text: js,
+		// Has the console await a resulting promise
+		Mapped: map[string]interface{}{"await": true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed evaluating: %w", err)
+	} else if reply.ResultID == "" {
+		return nil, fmt.Errorf("missing evaluation result ID")
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-a.doneCh:
+			return nil, fmt.Errorf("connection closed")
+		case raw := <-results:
+			var msg actorMessage
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				return nil, fmt.Errorf("invalid evaluation result: %w", err)
+			} else if msg.ResultID != reply.ResultID {
+				continue
+			} else if msg.thrown() {
+				evalErr := &EvalError{Message: gripText(msg.ExceptionMessage), Exception: msg.Exception}
+				if !jsonNull(msg.ExceptionMessage) {
+					if str, err := a.resolveString(ctx, msg.ExceptionMessage); err == nil {
+						evalErr.Message = str
+					}
+				}
+				return nil, evalErr
+			}
+			return msg.Result, nil
+		}
+	}
+}
+
+// True if the evaluation result is for a thrown exception, which can be null
+func (a *actorMessage) thrown() bool {
+	if a.HasException != nil {
+		return *a.HasException
+	}
+	return !jsonNull(a.Exception)
+}
+
+// True if the value is missing or null
+func jsonNull(v json.RawMessage) bool {
+	return len(v) == 0 || string(v) == "null"
+}
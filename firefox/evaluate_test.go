@@ -0,0 +1,89 @@
+package firefox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name string
+		// Sent with the result ID and actor
+		result          map[string]interface{}
+		expectedResult  string
+		expectedMessage string
+	}{
+		{
+			name: "null exception",
+			result: map[string]interface{}{
+				"type": "evaluationResult", "input": "1 + 2", "result": 3, "hasException": false,
+				"exception": nil, "exceptionMessage": nil, "helperResult": nil, "notes": nil,
+				"startTime": 1600000000000, "timestamp": 1600000000001,
+			},
+			expectedResult: "3",
+		},
+		{
+			name:           "null exception without has exception",
+			result:         map[string]interface{}{"type": "evaluationResult", "result": 3, "exception": nil},
+			expectedResult: "3",
+		},
+		{
+			name: "thrown error",
+			result: map[string]interface{}{
+				"type": "evaluationResult", "result": map[string]interface{}{"type": "undefined"}, "hasException": true,
+				"exception":        map[string]interface{}{"type": "object", "class": "Error", "actor": "obj1"},
+				"exceptionMessage": "Error: boom",
+			},
+			expectedMessage: "Error: boom",
+		},
+		{
+			name: "thrown null",
+			result: map[string]interface{}{
+				"type": "evaluationResult", "result": map[string]interface{}{"type": "undefined"}, "hasException": true,
+				"exception": map[string]interface{}{"type": "null"}, "exceptionMessage": nil,
+			},
+			expectedMessage: "null",
+		},
+		{
+			name: "thrown without has exception",
+			result: map[string]interface{}{
+				"type": "evaluationResult", "exception": map[string]interface{}{"type": "undefined"},
+				"exceptionMessage": "undefined",
+			},
+			expectedMessage: "undefined",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, s := newTestFirefox(t)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			type evalResult struct {
+				result string
+				err    error
+			}
+			resultCh := make(chan evalResult, 1)
+			go func() {
+				result, err := f.mgr.evaluate(ctx, "console1", "1 + 2")
+				resultCh <- evalResult{string(result), err}
+			}()
+			s.expect("console1", "evaluateJSAsync")
+			test.result["from"], test.result["resultID"] = "console1", "1-1"
+			s.send(map[string]interface{}{"from": "console1", "resultID": "1-1"}, test.result)
+			r := <-resultCh
+			var evalErr *EvalError
+			switch {
+			case test.expectedMessage == "" && r.err != nil:
+				t.Fatalf("expected result, got %v", r.err)
+			case test.expectedMessage == "" && r.result != test.expectedResult:
+				t.Fatalf("expected result %v, got %v", test.expectedResult, r.result)
+			case test.expectedMessage != "" && !errors.As(r.err, &evalErr):
+				t.Fatalf("expected eval error, got %v", r.err)
+			case test.expectedMessage != "" && evalErr.Message != test.expectedMessage:
+				t.Fatalf("expected message %q, got %q", test.expectedMessage, evalErr.Message)
+			}
+		})
+	}
+}
@@ -2,12 +2,15 @@ package firefox
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/therecipe/qt/widgets"
 	"go.uber.org/zap"
@@ -16,23 +19,47 @@ import (
 type Firefox struct {
 	RootActor
 	Widget *widgets.QWidget
+	// Set before Start returns
+	ServerInfo *ServerInfo
+	// For sending raw packets to any actor
+	Client *Client
+	// Fired when Ctrl+L or F6 is pressed while the page has keyboard focus. The
+	// key press does not reach the page.
+	AddressBarShortcutListener EventListener
 
 	config    Config
 	log       Logger
 	runCtx    context.Context
 	runCancel context.CancelFunc
 
-	cmd    *exec.Cmd
-	pid    uint32
-	remote *remote
+	cmd     *exec.Cmd
+	pid     uint32
+	remote  *remote
+	helloCh chan struct{}
+	// Whether the profile and port are claimed, governed by the claims lock
+	claimed bool
+
+	// Parent process console for chrome evaluation, lazily set
+	chromeConsoleActor string
+	chromeConsoleLock  sync.Mutex
+
+	// Lazily set
+	downloads     *downloadMonitor
+	downloadsLock sync.Mutex
+
+	// Platform specific
+	windowID        uintptr
+	keyHookThreadID uint32
 }
 
 type Config struct {
 	// Default is platform specific
 	FirefoxPath string
-	// Default is 49022
+	// Default is 49022. Must not be used by another instance or process, see
+	// Manager for running several instances.
 	DebugPort int
-	// Default is .profile in current dir
+	// Default is .profile in current dir. Must not be used by another
+	// instance.
 	ProfilePath string
 	// Default is no parent
 	Parent widgets.QWidget_ITF
@@ -40,15 +67,85 @@ type Config struct {
 	Log Logger
 	// Default is not to log remote messages (debug level)
 	LogRemoteMessages bool
+	// Default is not to log page console messages and errors
+	LogConsoleMessages bool
+	// Default is 64MB. A packet claiming to be larger closes the connection.
+	MaxPacketSize int
+	// Default is Firefox's default, which prompts for each download. If set,
+	// downloads are saved to this dir without prompting. It is created if not
+	// present. Firefox keeps prefs in the profile, so unsetting this later does
+	// not restore prompting.
+	DownloadDir string
+	// Default is false. If true, contextual identities (containers) are enabled
+	// for isolating tabs within the instance. See NewContainerTab.
+	Containers bool
+	// Default is no policy, all navigations are allowed
+	NavigationPolicy *NavigationPolicy
+	// Default is false. If true, Firefox is locked down for public use: prefs
+	// keep everything in one tab and avoid prompts, context menus and popups
+	// are hidden, internal pages other than about:blank, about:home, and
+	// about:newtab are blocked like NavigationPolicy blocks, and devtools and
+	// other browser shortcuts are swallowed while the page has focus.
+	Kiosk bool
+	// Default is no timeout other than the context given to Start
+	StartupTimeout time.Duration
+	// Default is no callback. Called synchronously from Start as each stage is
+	// reached.
+	OnStartupStage func(StartupStage)
+}
+
+// StartupStage is a step in Start. Stages are reached in order.
+type StartupStage int
+
+const (
+	StartupStageProfilePrepared StartupStage = iota
+	StartupStageProcessLaunched
+	StartupStagePIDFound
+	StartupStageWindowFound
+	StartupStageConnected
+	StartupStageHelloReceived
+)
+
+func (s StartupStage) String() string {
+	switch s {
+	case StartupStageProfilePrepared:
+		return "profile prepared"
+	case StartupStageProcessLaunched:
+		return "process launched"
+	case StartupStagePIDFound:
+		return "PID found"
+	case StartupStageWindowFound:
+		return "window found"
+	case StartupStageConnected:
+		return "connected"
+	case StartupStageHelloReceived:
+		return "root hello received"
+	default:
+		return "unknown stage " + strconv.Itoa(int(s))
+	}
 }
 
+// StartupError is returned from Start when a stage could not be reached. Stage
+// is the stage that was being attempted, not the last one reached.
+type StartupError struct {
+	Stage StartupStage
+	Err   error
+}
+
+func (s *StartupError) Error() string {
+	return fmt.Sprintf("firefox startup failed at %v: %v", s.Stage, s.Err)
+}
+
+func (s *StartupError) Unwrap() error { return s.Err }
+
 type Logger interface {
 	Debugf(string, ...interface{})
 	Infof(string, ...interface{})
 	Errorf(string, ...interface{})
 }
 
-// Context only for startup, should have timeout or could hang forever.
+// Context only for startup, should have timeout (or StartupTimeout set) or
+// could hang forever. Failures after defaults are applied are *StartupError.
 func Start(ctx context.Context, config Config) (*Firefox, error) {
 	// Set default config values
 	var err error
@@ -66,8 +163,30 @@ func Start(ctx context.Context, config Config) (*Firefox, error) {
 	if config.Log == nil {
 		config.Log = zap.S()
 	}
+	if config.MaxPacketSize == 0 {
+		config.MaxPacketSize = 64 * 1024 * 1024
+	}
+	if config.StartupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.StartupTimeout)
+		defer cancel()
+	}
+	// Make profile path absolute
+	if config.ProfilePath, err = filepath.Abs(config.ProfilePath); err != nil {
+		return nil, &StartupError{StartupStageProfilePrepared, fmt.Errorf("failed making profile path absolute: %w", err)}
+	}
+	if p := config.NavigationPolicy; p != nil && p.RedirectURL != "" &&
+		(!p.Allowed(p.RedirectURL) || (config.Kiosk && !kioskAllowed(p.RedirectURL))) {
+		return nil, &StartupError{StartupStageProfilePrepared,
+			fmt.Errorf("navigation policy redirect URL %v is not allowed", p.RedirectURL)}
+	}
+	if config.DownloadDir != "" {
+		if config.DownloadDir, err = filepath.Abs(config.DownloadDir); err != nil {
+			return nil, &StartupError{StartupStageProfilePrepared, fmt.Errorf("failed making download dir absolute: %w", err)}
+		}
+	}
 	// Instantiate and close on any failure
-	f := &Firefox{config: config, log: config.Log}
+	f := &Firefox{config: config, log: config.Log, helloCh: make(chan struct{})}
 	f.runCtx, f.runCancel = context.WithCancel(context.Background())
 	success := false
 	defer func() {
@@ -75,58 +194,149 @@ func Start(ctx context.Context, config Config) (*Firefox, error) {
 			f.Close()
 		}
 	}()
-	// Make profile path absolute
-	if config.ProfilePath, err = filepath.Abs(config.ProfilePath); err != nil {
-		return nil, fmt.Errorf("failed making profile path absolute: %w", err)
+	// Make sure no other instance has the profile or port
+	if err := f.claim(); err != nil {
+		return nil, &StartupError{StartupStageProfilePrepared, err}
 	}
 	// Create the profile
 	if err := f.prepareProfile(); err != nil {
-		return nil, err
+		return nil, &StartupError{StartupStageProfilePrepared, err}
 	}
+	f.startupStageReached(StartupStageProfilePrepared)
 	// Start firefox with the profile and remote port. Sometimes Firefox starts
 	// another process and kills this one immediately, sometimes it leaves this
-	// one open depending on whether started from the console or UI.
+	// one open depending on whether started from the console or UI. We don't
+	// tie it to the context because the context is only for startup. No remote
+	// keeps it from handing off to or taking URLs from another instance.
 	debugPortStr := strconv.Itoa(config.DebugPort)
-	cmd := exec.CommandContext(ctx, config.FirefoxPath, "-profile", config.ProfilePath,
+	cmd := exec.Command(config.FirefoxPath, "-profile", config.ProfilePath, "-no-remote",
 		"-start-debugger-server", debugPortStr)
 	// From console firefox starts another process, but not from UI directly
 	f.log.Debugf("Running %v", cmd)
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed starting firefox: %w", err)
+		return nil, &StartupError{StartupStageProcessLaunched, fmt.Errorf("failed starting firefox: %w", err)}
 	}
+	f.cmd = cmd
+	f.startupStageReached(StartupStageProcessLaunched)
 	// Set the PID and widget
 	if err = f.findAndSetPID(ctx); err != nil {
-		return nil, err
-	} else if err = f.findAndSetWidget(ctx); err != nil {
-		return nil, err
+		return nil, &StartupError{StartupStagePIDFound, err}
+	}
+	f.startupStageReached(StartupStagePIDFound)
+	if err = f.findAndSetWidget(ctx); err != nil {
+		return nil, &StartupError{StartupStageWindowFound, err}
+	}
+	f.startupStageReached(StartupStageWindowFound)
+	// Not being able to intercept keys is not fatal
+	if err := f.startKeyHook(); err != nil {
+		f.log.Errorf("Failed starting key hook: %v", err)
 	}
 	// Start remote
 	f.log.Debugf("Connecting to remote on 127.0.0.1:%v", debugPortStr)
-	if f.remote, err = f.dialRemote("127.0.0.1:" + debugPortStr); err != nil {
-		return nil, fmt.Errorf("failed connecting to remove: %w", err)
+	if f.remote, err = f.dialRemote(ctx, "127.0.0.1:"+debugPortStr); err != nil {
+		return nil, &StartupError{StartupStageConnected, fmt.Errorf("failed connecting to remote: %w", err)}
 	}
+	f.startupStageReached(StartupStageConnected)
 	// Create actor manager, add root to it, and run it in background
 	f.mgr = f.newActorManager()
 	f.mgr.setActor("root", &f.RootActor)
+	f.Client = &Client{mgr: f.mgr}
+	runErrCh := make(chan error, 1)
 	go func() {
-		if err := f.mgr.run(); err != nil {
+		err := f.mgr.run()
+		if err != nil {
 			f.log.Errorf("Actor manager failed: %v", err)
 		}
+		runErrCh <- err
 	}()
+	// Wait for the root hello, the first packet sent on connect
+	select {
+	case <-f.helloCh:
+	case err := <-runErrCh:
+		if err == nil {
+			err = fmt.Errorf("connection closed")
+		}
+		return nil, &StartupError{StartupStageHelloReceived, err}
+	case <-ctx.Done():
+		return nil, &StartupError{StartupStageHelloReceived, ctx.Err()}
+	}
+	// Fill out the rest of the server info. Versions are informational, so
+	// failing to get them is not fatal.
+	if err := f.loadServerVersion(ctx); err != nil {
+		f.log.Errorf("Failed loading server version: %v", err)
+	}
+	f.startupStageReached(StartupStageHelloReceived)
 	success = true
 	return f, nil
 }
 
-func (f *Firefox) Close() error {
-	f.runCancel()
-	// Kill cmd if present, ignore error
-	if f.cmd != nil {
-		f.cmd.Process.Kill()
+// ServerInfo is from the root hello and the device description
+type ServerInfo struct {
+	// Usually "browser"
+	ApplicationType string
+	// Firefox version, e.g. "83.0". Empty if it couldn't be loaded.
+	Version string
+	// Gecko platform version. Empty if it couldn't be loaded.
+	PlatformVersion string
+	// Values are usually bools
+	Traits map[string]interface{}
+}
+
+// True if the trait is present and true
+func (s *ServerInfo) HasTrait(name string) bool {
+	v, _ := s.Traits[name].(bool)
+	return v
+}
+
+func (f *Firefox) loadServerVersion(ctx context.Context) error {
+	// The hello doesn't have versions, so get them from the device actor
+	root, err := f.mgr.request(ctx, &actorMessage{To: "root", Type: "getRoot"})
+	if err != nil {
+		return fmt.Errorf("failed getting root: %w", err)
+	} else if root.DeviceActor == "" {
+		return fmt.Errorf("no device actor")
 	}
-	// Close remote if present, ignore error
-	if f.remote != nil {
-		f.remote.rw.Close()
+	desc, err := f.mgr.request(ctx, &actorMessage{To: root.DeviceActor, Type: "getDescription"})
+	if err != nil {
+		return fmt.Errorf("failed getting device description: %w", err)
+	}
+	var descValue struct {
+		AppVersion      string `json:"appversion"`
+		PlatformVersion string `json:"platformversion"`
+	}
+	if err := json.Unmarshal(desc.Value, &descValue); err != nil {
+		return fmt.Errorf("invalid device description: %w", err)
+	}
+	f.ServerInfo.Version = descValue.AppVersion
+	f.ServerInfo.PlatformVersion = descValue.PlatformVersion
+	return nil
+}
+
+func (f *Firefox) startupStageReached(stage StartupStage) {
+	f.log.Debugf("Startup stage reached: %v", stage)
+	if f.config.OnStartupStage != nil {
+		f.config.OnStartupStage(stage)
 	}
+}
+
+// FocusPage gives the embedded page native keyboard focus. This should be
+// called from the UI thread.
+func (f *Firefox) FocusPage() error {
+	if err := f.activateNativeWindow(); err != nil {
+		return fmt.Errorf("failed focusing page: %w", err)
+	}
+	return nil
+}
+
+// PageHasFocus is true if the embedded page has native keyboard focus
+func (f *Firefox) PageHasFocus() bool {
+	return f.nativeWindowHasFocus()
+}
+
+// Close kills Firefox. See Shutdown to let it exit cleanly first.
+func (f *Firefox) Close() error {
+	defer f.release()
+	f.closeConnection()
 	// Kill PID
 	if f.pid != 0 {
 		if p, err := os.FindProcess(int(f.pid)); err != nil {
@@ -138,6 +348,20 @@ func (f *Firefox) Close() error {
 	return nil
 }
 
+// Stops everything but the Firefox process
+func (f *Firefox) closeConnection() {
+	f.runCancel()
+	f.stopKeyHook()
+	// Kill cmd if present, ignore error
+	if f.cmd != nil {
+		f.cmd.Process.Kill()
+	}
+	// Close remote if present, ignore error
+	if f.remote != nil {
+		f.remote.rw.Close()
+	}
+}
+
 const defaultUserJS = `
 user_pref("browser.shell.checkDefaultBrowser", false);
 user_pref("browser.tabs.drawInTitlebar", false);
@@ -167,6 +391,19 @@ func (f *Firefox) prepareProfile() error {
 			return fmt.Errorf("failed writing user.js: %w", err)
 		}
 	}
+	if err := f.writeConfigSection(userJSPath, userJSSection, f.configPrefsJS()); err != nil {
+		return err
+	}
+	if p := f.config.NavigationPolicy; p != nil && p.EnterprisePolicy {
+		if err := f.writeEnterprisePolicy(); err != nil {
+			f.log.Errorf("Failed writing enterprise policy, navigation policy is only enforced client-side: %v", err)
+		}
+	}
+	if f.config.DownloadDir != "" {
+		if err := os.MkdirAll(f.config.DownloadDir, 0755); err != nil {
+			return fmt.Errorf("failed creating download dir: %w", err)
+		}
+	}
 	// Create the userChrome.css if not there
 	userChromeCSSPath := filepath.Join(f.config.ProfilePath, "chrome", "userChrome.css")
 	if err := os.MkdirAll(filepath.Dir(userChromeCSSPath), 0755); err != nil {
@@ -177,6 +414,9 @@ func (f *Firefox) prepareProfile() error {
 			return fmt.Errorf("failed writing userChrome.css: %w", err)
 		}
 	}
+	if err := f.writeConfigSection(userChromeCSSPath, userChromeCSSSection, f.configUserChromeCSS()); err != nil {
+		return err
+	}
 
 	// That's enough. We intentionally don't create the profile via -CreateProfile
 	// because Firefox would put it in the INI file. Rather, just giving the
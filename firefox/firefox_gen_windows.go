@@ -39,13 +39,28 @@ func errnoErr(e syscall.Errno) error {
 
 var (
 	modiphlpapi = windows.NewLazySystemDLL("iphlpapi.dll")
+	modkernel32 = windows.NewLazySystemDLL("kernel32.dll")
 	moduser32   = windows.NewLazySystemDLL("user32.dll")
 
 	procGetTcpTable2             = modiphlpapi.NewProc("GetTcpTable2")
+	procGetTickCount             = modkernel32.NewProc("GetTickCount")
+	procAttachThreadInput        = moduser32.NewProc("AttachThreadInput")
+	procCallNextHookEx           = moduser32.NewProc("CallNextHookEx")
 	procEnumWindows              = moduser32.NewProc("EnumWindows")
 	procFindWindowW              = moduser32.NewProc("FindWindowW")
+	procGetAncestor              = moduser32.NewProc("GetAncestor")
+	procGetAsyncKeyState         = moduser32.NewProc("GetAsyncKeyState")
 	procGetClassNameW            = moduser32.NewProc("GetClassNameW")
+	procGetForegroundWindow      = moduser32.NewProc("GetForegroundWindow")
+	procGetGUIThreadInfo         = moduser32.NewProc("GetGUIThreadInfo")
+	procGetLastInputInfo         = moduser32.NewProc("GetLastInputInfo")
+	procGetMessageW              = moduser32.NewProc("GetMessageW")
 	procGetWindowThreadProcessId = moduser32.NewProc("GetWindowThreadProcessId")
+	procPostMessageW             = moduser32.NewProc("PostMessageW")
+	procPostThreadMessageW       = moduser32.NewProc("PostThreadMessageW")
+	procSetFocus                 = moduser32.NewProc("SetFocus")
+	procSetWindowsHookExW        = moduser32.NewProc("SetWindowsHookExW")
+	procUnhookWindowsHookEx      = moduser32.NewProc("UnhookWindowsHookEx")
 )
 
 func getTcpTable2(tcpTable *mibTCPTable2, sizePointer *uint32, order bool) (res syscall.Errno) {
@@ -58,6 +73,30 @@ func getTcpTable2(tcpTable *mibTCPTable2, sizePointer *uint32, order bool) (res
 	return
 }
 
+func getTickCount() (ticks uint32) {
+	r0, _, _ := syscall.Syscall(procGetTickCount.Addr(), 0, 0, 0, 0)
+	ticks = uint32(r0)
+	return
+}
+
+func attachThreadInput(attach uint32, attachTo uint32, doAttach bool) (err error) {
+	var _p0 uint32
+	if doAttach {
+		_p0 = 1
+	}
+	r1, _, e1 := syscall.Syscall(procAttachThreadInput.Addr(), 3, uintptr(attach), uintptr(attachTo), uintptr(_p0))
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callNextHookEx(hook syscall.Handle, code int, wParam uintptr, lParam uintptr) (res uintptr) {
+	r0, _, _ := syscall.Syscall6(procCallNextHookEx.Addr(), 4, uintptr(hook), uintptr(code), uintptr(wParam), uintptr(lParam), 0, 0)
+	res = uintptr(r0)
+	return
+}
+
 func enumWindows(lpEnumFunc uintptr, lParam uintptr) (ok bool) {
 	r0, _, _ := syscall.Syscall(procEnumWindows.Addr(), 2, uintptr(lpEnumFunc), uintptr(lParam), 0)
 	ok = r0 != 0
@@ -73,6 +112,18 @@ func findWindow(className *uint16, windowName *uint16) (handle syscall.Handle, e
 	return
 }
 
+func getAncestor(handle syscall.Handle, flags uint32) (ancestor syscall.Handle) {
+	r0, _, _ := syscall.Syscall(procGetAncestor.Addr(), 2, uintptr(handle), uintptr(flags), 0)
+	ancestor = syscall.Handle(r0)
+	return
+}
+
+func getAsyncKeyState(key int32) (state uint16) {
+	r0, _, _ := syscall.Syscall(procGetAsyncKeyState.Addr(), 1, uintptr(key), 0, 0)
+	state = uint16(r0)
+	return
+}
+
 func getClassName(handle syscall.Handle, className *uint16, classNameMax int32) (classNameLen int32, err error) {
 	r0, _, e1 := syscall.Syscall(procGetClassNameW.Addr(), 3, uintptr(handle), uintptr(unsafe.Pointer(className)), uintptr(classNameMax))
 	classNameLen = int32(r0)
@@ -82,8 +133,69 @@ func getClassName(handle syscall.Handle, className *uint16, classNameMax int32)
 	return
 }
 
+func getForegroundWindow() (handle syscall.Handle) {
+	r0, _, _ := syscall.Syscall(procGetForegroundWindow.Addr(), 0, 0, 0, 0)
+	handle = syscall.Handle(r0)
+	return
+}
+
+func getGUIThreadInfo(threadID uint32, info *guiThreadInfo) (err error) {
+	r1, _, e1 := syscall.Syscall(procGetGUIThreadInfo.Addr(), 2, uintptr(threadID), uintptr(unsafe.Pointer(info)), 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func getLastInputInfo(info *lastInputInfo) (ok bool) {
+	r0, _, _ := syscall.Syscall(procGetLastInputInfo.Addr(), 1, uintptr(unsafe.Pointer(info)), 0, 0)
+	ok = r0 != 0
+	return
+}
+
+func getMessage(msg *winMsg, handle syscall.Handle, msgFilterMin uint32, msgFilterMax uint32) (res int32) {
+	r0, _, _ := syscall.Syscall6(procGetMessageW.Addr(), 4, uintptr(unsafe.Pointer(msg)), uintptr(handle), uintptr(msgFilterMin), uintptr(msgFilterMax), 0, 0)
+	res = int32(r0)
+	return
+}
+
 func getWindowThreadProcessID(handle syscall.Handle, processID *uint32) (threadID uint32) {
 	r0, _, _ := syscall.Syscall(procGetWindowThreadProcessId.Addr(), 2, uintptr(handle), uintptr(unsafe.Pointer(processID)), 0)
 	threadID = uint32(r0)
 	return
 }
+
+func postMessage(handle syscall.Handle, msg uint32, wParam uintptr, lParam uintptr) (err error) {
+	r1, _, e1 := syscall.Syscall6(procPostMessageW.Addr(), 4, uintptr(handle), uintptr(msg), uintptr(wParam), uintptr(lParam), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func postThreadMessage(threadID uint32, msg uint32, wParam uintptr, lParam uintptr) (ok bool) {
+	r0, _, _ := syscall.Syscall6(procPostThreadMessageW.Addr(), 4, uintptr(threadID), uintptr(msg), uintptr(wParam), uintptr(lParam), 0, 0)
+	ok = r0 != 0
+	return
+}
+
+func setFocus(handle syscall.Handle) (prevHandle syscall.Handle) {
+	r0, _, _ := syscall.Syscall(procSetFocus.Addr(), 1, uintptr(handle), 0, 0)
+	prevHandle = syscall.Handle(r0)
+	return
+}
+
+func setWindowsHookEx(hookType int32, fn uintptr, mod syscall.Handle, threadID uint32) (hook syscall.Handle, err error) {
+	r0, _, e1 := syscall.Syscall6(procSetWindowsHookExW.Addr(), 4, uintptr(hookType), uintptr(fn), uintptr(mod), uintptr(threadID), 0, 0)
+	hook = syscall.Handle(r0)
+	if hook == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func unhookWindowsHookEx(hook syscall.Handle) (ok bool) {
+	r0, _, _ := syscall.Syscall(procUnhookWindowsHookEx.Addr(), 1, uintptr(hook), 0, 0)
+	ok = r0 != 0
+	return
+}
@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package firefox
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Embedding is only implemented on Windows. These let the package build
+// elsewhere so the protocol code can be tested.
+
+var errUnsupportedPlatform = fmt.Errorf("embedding not supported on this platform")
+
+func findFirefoxPath() (string, error) { return "", errUnsupportedPlatform }
+
+func (f *Firefox) findAndSetPID(ctx context.Context) error { return errUnsupportedPlatform }
+
+func (f *Firefox) findAndSetWidget(ctx context.Context) error { return errUnsupportedPlatform }
+
+func (f *Firefox) activateNativeWindow() error { return errUnsupportedPlatform }
+
+func (f *Firefox) closeNativeWindow() error { return errUnsupportedPlatform }
+
+func (f *Firefox) nativeWindowHasFocus() bool { return false }
+
+func (f *Firefox) startKeyHook() error { return errUnsupportedPlatform }
+
+func (f *Firefox) stopKeyHook() {}
+
+// IdleTime is always 0 on this platform
+func IdleTime() time.Duration { return 0 }
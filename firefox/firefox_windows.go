@@ -6,6 +6,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 	"unsafe"
@@ -64,6 +67,7 @@ func (f *Firefox) findAndSetWidget(ctx context.Context) error {
 				continue
 			}
 			f.log.Debugf("Found HWND: %X", windowID)
+			f.windowID = windowID
 			win := gui.QWindow_FromWinId(windowID)
 			if win == nil {
 				return fmt.Errorf("failed capturing window")
@@ -75,6 +79,165 @@ func (f *Firefox) findAndSetWidget(ctx context.Context) error {
 	}
 }
 
+func (f *Firefox) activateNativeWindow() error {
+	if f.windowID == 0 {
+		return fmt.Errorf("no window")
+	}
+	// Keyboard focus can only be set on a window of a thread sharing our input
+	// state, so attach to the Firefox UI thread while setting it. The thread
+	// must not change during this.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var pid uint32
+	ffThreadID := getWindowThreadProcessID(syscall.Handle(f.windowID), &pid)
+	ourThreadID := windows.GetCurrentThreadId()
+	if ffThreadID != ourThreadID {
+		if err := attachThreadInput(ourThreadID, ffThreadID, true); err != nil {
+			return fmt.Errorf("failed attaching thread input: %w", err)
+		}
+		defer attachThreadInput(ourThreadID, ffThreadID, false)
+	}
+	setFocus(syscall.Handle(f.windowID))
+	return nil
+}
+
+// Asks the window to close like the user would, which quits Firefox if it's
+// the last window
+func (f *Firefox) closeNativeWindow() error {
+	if f.windowID == 0 {
+		return fmt.Errorf("no window")
+	}
+	return postMessage(syscall.Handle(f.windowID), wmClose, 0, 0)
+}
+
+func (f *Firefox) nativeWindowHasFocus() bool {
+	if f.windowID == 0 {
+		return false
+	}
+	// Our top-level window must be in the foreground and the Firefox UI thread
+	// must have a focused window
+	if fg := getForegroundWindow(); fg == 0 || getAncestor(syscall.Handle(f.windowID), gaRootOwner) != fg {
+		return false
+	}
+	var pid uint32
+	info := guiThreadInfo{}
+	info.size = uint32(unsafe.Sizeof(info))
+	ffThreadID := getWindowThreadProcessID(syscall.Handle(f.windowID), &pid)
+	return getGUIThreadInfo(ffThreadID, &info) == nil && info.focus != 0
+}
+
+// Callbacks are never freed and are limited in number, so there is only one
+// for all hooks. It's called on the thread that set the hook.
+var keyHookCallback = syscall.NewCallback(onLowLevelKey)
+
+// Keyed by hook thread ID
+var keyHooks = map[uint32]*Firefox{}
+var keyHooksLock sync.RWMutex
+
+func onLowLevelKey(code int, wParam uintptr, key *kbdLLHookStruct) uintptr {
+	keyHooksLock.RLock()
+	f := keyHooks[windows.GetCurrentThreadId()]
+	keyHooksLock.RUnlock()
+	if f == nil {
+		return callNextHookEx(0, code, wParam, uintptr(unsafe.Pointer(key)))
+	}
+	return f.onLowLevelKey(code, wParam, key)
+}
+
+// Installs a low-level keyboard hook on its own thread that swallows the
+// address bar shortcuts while the page has focus and fires the listener
+func (f *Firefox) startKeyHook() error {
+	errCh := make(chan error, 1)
+	go func() {
+		// Hook callbacks are delivered on this thread's message loop
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		threadID := windows.GetCurrentThreadId()
+		keyHooksLock.Lock()
+		keyHooks[threadID] = f
+		keyHooksLock.Unlock()
+		defer func() {
+			keyHooksLock.Lock()
+			defer keyHooksLock.Unlock()
+			delete(keyHooks, threadID)
+		}()
+		hook, err := setWindowsHookEx(whKeyboardLL, keyHookCallback, 0, 0)
+		if err != nil {
+			errCh <- fmt.Errorf("failed setting keyboard hook: %w", err)
+			return
+		}
+		defer unhookWindowsHookEx(hook)
+		f.keyHookThreadID = threadID
+		errCh <- nil
+		var msg winMsg
+		for {
+			// Returns 0 on WM_QUIT and -1 on error
+			if res := getMessage(&msg, 0, 0, 0); res == 0 || res == -1 {
+				return
+			}
+		}
+	}()
+	return <-errCh
+}
+
+func (f *Firefox) stopKeyHook() {
+	if f.keyHookThreadID != 0 {
+		postThreadMessage(f.keyHookThreadID, wmQuit, 0, 0)
+	}
+}
+
+func (f *Firefox) onLowLevelKey(code int, wParam uintptr, key *kbdLLHookStruct) uintptr {
+	if code == 0 && (wParam == wmKeyDown || wParam == wmSysKeyDown) {
+		ctrlDown := getAsyncKeyState(vkControl)&0x8000 != 0
+		if (key.vkCode == vkF6 || (key.vkCode == 'L' && ctrlDown)) && f.nativeWindowHasFocus() {
+			f.AddressBarShortcutListener.Fire()
+			// Swallow it
+			return 1
+		}
+		if f.config.Kiosk {
+			shiftDown := getAsyncKeyState(vkShift)&0x8000 != 0
+			altDown := getAsyncKeyState(vkMenu)&0x8000 != 0
+			if kioskBlockedKey(key.vkCode, ctrlDown, shiftDown, altDown) && f.nativeWindowHasFocus() {
+				return 1
+			}
+		}
+	}
+	return callNextHookEx(0, code, wParam, uintptr(unsafe.Pointer(key)))
+}
+
+// Ctrl+Shift shortcuts to keep. Z is redo in text fields.
+const kioskAllowedCtrlShiftKeys = "Z"
+
+// Ctrl shortcuts that open sidebars, windows, tabs, dialogs, or source
+const kioskBlockedCtrlKeys = "BDHJNOPSTUW"
+
+// Devtools, help, caret browsing, fullscreen, and browser shortcuts
+func kioskBlockedKey(vk uint32, ctrl, shift, alt bool) bool {
+	switch {
+	case vk == vkF1 || vk == vkF7 || vk == vkF11 || vk == vkF12:
+		return true
+	case vk == vkF4:
+		return ctrl || alt
+	case ctrl && shift:
+		return vk == vkDelete || (vk >= 'A' && vk <= 'Z' && !strings.ContainsRune(kioskAllowedCtrlShiftKeys, rune(vk)))
+	case ctrl:
+		return vk >= 'A' && vk <= 'Z' && strings.ContainsRune(kioskBlockedCtrlKeys, rune(vk))
+	}
+	return false
+}
+
+// IdleTime is how long since the last keyboard or mouse input. This is for the
+// whole system, not just Firefox or this app.
+func IdleTime() time.Duration {
+	info := lastInputInfo{}
+	info.size = uint32(unsafe.Sizeof(info))
+	if !getLastInputInfo(&info) {
+		return 0
+	}
+	// Tick counts wrap, but the difference is still right
+	return time.Duration(getTickCount()-info.time) * time.Millisecond
+}
+
 // 0 with no error if not found
 func getPIDListeningOnLocalhostPort(port int) (uint32, error) {
 	// Keep trying until our buffer was large enough
@@ -162,8 +325,75 @@ type mibTCPRow2 struct {
 	offloadState uint32
 }
 
+type guiThreadInfo struct {
+	size      uint32
+	flags     uint32
+	active    syscall.Handle
+	focus     syscall.Handle
+	capture   syscall.Handle
+	menuOwner syscall.Handle
+	moveSize  syscall.Handle
+	caret     syscall.Handle
+	caretRect [4]int32
+}
+
+type kbdLLHookStruct struct {
+	vkCode    uint32
+	scanCode  uint32
+	flags     uint32
+	time      uint32
+	extraInfo uintptr
+}
+
+type lastInputInfo struct {
+	size uint32
+	time uint32
+}
+
+type winMsg struct {
+	hwnd    syscall.Handle
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	pt      [2]int32
+}
+
+const (
+	whKeyboardLL = 13
+	wmClose      = 0x0010
+	wmQuit       = 0x0012
+	wmKeyDown    = 0x0100
+	wmSysKeyDown = 0x0104
+	vkShift      = 0x10
+	vkControl    = 0x11
+	vkMenu       = 0x12
+	vkDelete     = 0x2E
+	vkF1         = 0x70
+	vkF4         = 0x73
+	vkF6         = 0x75
+	vkF7         = 0x76
+	vkF11        = 0x7A
+	vkF12        = 0x7B
+	gaRootOwner  = 3
+)
+
 //sys	findWindow(className *uint16, windowName *uint16) (handle syscall.Handle, err error) = user32.FindWindowW
 //sys enumWindows(lpEnumFunc uintptr, lParam uintptr) (ok bool) = user32.EnumWindows
 //sys getWindowThreadProcessID(handle syscall.Handle, processID *uint32) (threadID uint32) = user32.GetWindowThreadProcessId
 //sys getClassName(handle syscall.Handle, className *uint16, classNameMax int32) (classNameLen int32, err error) = user32.GetClassNameW
 //sys getTcpTable2(tcpTable *mibTCPTable2, sizePointer *uint32, order bool) (res syscall.Errno) = iphlpapi.GetTcpTable2
+//sys attachThreadInput(attach uint32, attachTo uint32, doAttach bool) (err error) = user32.AttachThreadInput
+//sys setFocus(handle syscall.Handle) (prevHandle syscall.Handle) = user32.SetFocus
+//sys getForegroundWindow() (handle syscall.Handle) = user32.GetForegroundWindow
+//sys getAncestor(handle syscall.Handle, flags uint32) (ancestor syscall.Handle) = user32.GetAncestor
+//sys getGUIThreadInfo(threadID uint32, info *guiThreadInfo) (err error) = user32.GetGUIThreadInfo
+//sys setWindowsHookEx(hookType int32, fn uintptr, mod syscall.Handle, threadID uint32) (hook syscall.Handle, err error) = user32.SetWindowsHookExW
+//sys unhookWindowsHookEx(hook syscall.Handle) (ok bool) = user32.UnhookWindowsHookEx
+//sys callNextHookEx(hook syscall.Handle, code int, wParam uintptr, lParam uintptr) (res uintptr) = user32.CallNextHookEx
+//sys getAsyncKeyState(key int32) (state uint16) = user32.GetAsyncKeyState
+//sys getMessage(msg *winMsg, handle syscall.Handle, msgFilterMin uint32, msgFilterMax uint32) (res int32) = user32.GetMessageW
+//sys postThreadMessage(threadID uint32, msg uint32, wParam uintptr, lParam uintptr) (ok bool) = user32.PostThreadMessageW
+//sys postMessage(handle syscall.Handle, msg uint32, wParam uintptr, lParam uintptr) (err error) = user32.PostMessageW
+//sys getLastInputInfo(info *lastInputInfo) (ok bool) = user32.GetLastInputInfo
+//sys getTickCount() (ticks uint32) = kernel32.GetTickCount
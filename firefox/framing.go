@@ -0,0 +1,143 @@
+package firefox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Remote debugging protocol packets are framed as the decimal byte length of
+// the JSON, a colon, then the JSON. Bulk packets ("bulk <actor> <type>
+// <length>:<data>") are not supported.
+
+// Max digits in a packet length, enough for any int32
+const maxPacketSizeDigits = 10
+
+var (
+	// ErrPacketTooLarge is returned when a packet header has a length larger
+	// than the max
+	ErrPacketTooLarge = errors.New("packet too large")
+	// ErrBulkPacket is returned when a bulk packet header is seen
+	ErrBulkPacket = errors.New("bulk packets not supported")
+)
+
+// PacketHeaderError is returned for malformed packet headers
+type PacketHeaderError struct {
+	// Offset of the invalid byte within the header
+	Offset int
+	Byte   byte
+	Reason string
+}
+
+func (p *PacketHeaderError) Error() string {
+	return fmt.Sprintf("invalid packet header byte %q at offset %v: %v", p.Byte, p.Offset, p.Reason)
+}
+
+// Tracks the header state, shared by the stream and incremental parsers
+type packetHeader struct {
+	maxSize int
+	size    int
+	digits  int
+}
+
+// Returns true when the header is complete. Errors are final.
+func (p *packetHeader) feed(b byte) (bool, error) {
+	switch {
+	case b >= '0' && b <= '9':
+		if p.digits >= maxPacketSizeDigits {
+			return false, &PacketHeaderError{Offset: p.digits, Byte: b, Reason: "length has too many digits"}
+		}
+		p.size = p.size*10 + int(b-'0')
+		p.digits++
+		if p.size > p.maxSize {
+			return false, fmt.Errorf("%w: length over %v", ErrPacketTooLarge, p.maxSize)
+		}
+		return false, nil
+	case b == ':':
+		if p.digits == 0 {
+			return false, &PacketHeaderError{Offset: p.digits, Byte: b, Reason: "missing length"}
+		}
+		return true, nil
+	case b == 'b' && p.digits == 0:
+		return false, ErrBulkPacket
+	default:
+		return false, &PacketHeaderError{Offset: p.digits, Byte: b, Reason: "expected digit or colon"}
+	}
+}
+
+// ReadPacketHeader reads a packet header up to and including the colon and
+// returns the length of the packet that follows. A length larger than maxSize
+// is ErrPacketTooLarge and a malformed header is *PacketHeaderError. At most
+// 11 bytes are read. An io.EOF before any byte is returned as is, an EOF in
+// the middle of the header is io.ErrUnexpectedEOF.
+func ReadPacketHeader(r io.ByteReader, maxSize int) (int, error) {
+	h := packetHeader{maxSize: maxSize}
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF && h.digits > 0 {
+			return 0, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return 0, err
+		}
+		if done, err := h.feed(b); err != nil {
+			return 0, err
+		} else if done {
+			return h.size, nil
+		}
+	}
+}
+
+// PacketParser incrementally parses packets from arbitrarily split data. The
+// zero value is not usable, use NewPacketParser.
+type PacketParser struct {
+	header packetHeader
+	// Nil while reading the header
+	body []byte
+	err  error
+}
+
+func NewPacketParser(maxSize int) *PacketParser {
+	return &PacketParser{header: packetHeader{maxSize: maxSize}}
+}
+
+// Feed parses the data and returns any packets completed by it. The data is
+// not retained and returned packets are not reused. Once an error is
+// returned, every later call returns the same error.
+func (p *PacketParser) Feed(data []byte) (packets [][]byte, err error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	for len(data) > 0 {
+		// Read header bytes
+		if p.body == nil {
+			done, err := p.header.feed(data[0])
+			data = data[1:]
+			if err != nil {
+				p.err = err
+				return packets, err
+			} else if done {
+				p.body = make([]byte, 0, p.header.size)
+			}
+		}
+		// Read body bytes
+		if p.body != nil {
+			n := p.header.size - len(p.body)
+			if n > len(data) {
+				n = len(data)
+			}
+			p.body = append(p.body, data[:n]...)
+			data = data[n:]
+			if len(p.body) == p.header.size {
+				packets = append(packets, p.body)
+				p.body = nil
+				p.header = packetHeader{maxSize: p.header.maxSize}
+			}
+		}
+	}
+	return packets, nil
+}
+
+// Pending is true if a packet has been partially fed
+func (p *PacketParser) Pending() bool {
+	return p.body != nil || p.header.digits > 0
+}
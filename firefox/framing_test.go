@@ -0,0 +1,173 @@
+//go:build go1.18
+// +build go1.18
+
+package firefox
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+)
+
+// Reference framing, parsed as plainly as possible to check the parsers
+// against
+
+// The header's packet length and byte length, false if the data doesn't
+// start with a complete valid header
+func referenceHeader(data []byte, maxSize int) (size int, headerLen int, ok bool) {
+	colon := bytes.IndexByte(data, ':')
+	if colon < 1 || colon > maxPacketSizeDigits {
+		return 0, 0, false
+	}
+	for _, b := range data[:colon] {
+		if b < '0' || b > '9' {
+			return 0, 0, false
+		}
+	}
+	size, err := strconv.Atoi(string(data[:colon]))
+	if err != nil || size > maxSize {
+		return 0, 0, false
+	}
+	return size, colon + 1, true
+}
+
+// True if more data could make the data a valid header
+func referenceHeaderPrefix(data []byte, maxSize int) bool {
+	if len(data) > maxPacketSizeDigits {
+		return false
+	}
+	for _, b := range data {
+		if b < '0' || b > '9' {
+			return false
+		}
+	}
+	size, err := strconv.Atoi(string(data))
+	return len(data) == 0 || (err == nil && size <= maxSize)
+}
+
+// Packets until the data ends or is invalid. Rest is the incomplete data
+// after the packets, invalid is true if the data after them can't be a packet.
+func referencePackets(data []byte, maxSize int) (packets [][]byte, rest []byte, invalid bool) {
+	for len(data) > 0 {
+		size, headerLen, ok := referenceHeader(data, maxSize)
+		if !ok {
+			if referenceHeaderPrefix(data, maxSize) {
+				return packets, data, false
+			}
+			return packets, nil, true
+		} else if len(data)-headerLen < size {
+			return packets, data, false
+		}
+		packets = append(packets, data[headerLen:headerLen+size])
+		data = data[headerLen+size:]
+	}
+	return packets, nil, false
+}
+
+func referenceFrame(packets [][]byte) []byte {
+	var framed []byte
+	for _, packet := range packets {
+		framed = strconv.AppendInt(framed, int64(len(packet)), 10)
+		framed = append(framed, ':')
+		framed = append(framed, packet...)
+	}
+	return framed
+}
+
+// Feeds the data split into chunks sized by split
+func feedSplit(t *testing.T, p *PacketParser, data []byte, split uint8) (packets [][]byte, err error) {
+	t.Helper()
+	for i := 0; len(data) > 0; i++ {
+		n := int(split)>>(i%4) + 1
+		if n > len(data) {
+			n = len(data)
+		}
+		fed, err := p.Feed(data[:n])
+		packets = append(packets, fed...)
+		if err != nil {
+			return packets, err
+		}
+		data = data[n:]
+	}
+	return packets, nil
+}
+
+func FuzzReadPacketHeader(f *testing.F) {
+	f.Add([]byte("0:"), uint16(0))
+	f.Add([]byte("0000000042:{}"), uint16(100))
+	f.Add([]byte("12345678901:"), uint16(65535))
+	f.Add([]byte(":{}"), uint16(100))
+	f.Add([]byte("12"), uint16(100))
+	f.Fuzz(func(t *testing.T, data []byte, maxSize uint16) {
+		r := bytes.NewReader(data)
+		size, err := ReadPacketHeader(r, int(maxSize))
+		read := len(data) - r.Len()
+		if read > maxPacketSizeDigits+1 {
+			t.Fatalf("read %v bytes", read)
+		}
+		refSize, refHeaderLen, ok := referenceHeader(data, int(maxSize))
+		switch {
+		case ok && err != nil:
+			t.Fatalf("expected size %v, got %v", refSize, err)
+		case ok && (size != refSize || read != refHeaderLen):
+			t.Fatalf("expected size %v from %v bytes, got %v from %v", refSize, refHeaderLen, size, read)
+		case !ok && err == nil:
+			t.Fatalf("expected error, got size %v", size)
+		case !ok && len(data) == 0 && err != io.EOF:
+			t.Fatalf("expected EOF, got %v", err)
+		case !ok && len(data) > 0 && referenceHeaderPrefix(data, int(maxSize)) && err != io.ErrUnexpectedEOF:
+			t.Fatalf("expected unexpected EOF, got %v", err)
+		}
+		// Invalid headers have a known error
+		var headerErr *PacketHeaderError
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF && !errors.Is(err, ErrPacketTooLarge) &&
+			!errors.Is(err, ErrBulkPacket) && !errors.As(err, &headerErr) {
+			t.Fatalf("unexpected error type %T: %v", err, err)
+		}
+	})
+}
+
+func FuzzPacketParser(f *testing.F) {
+	f.Add([]byte("2:{}0:3:[1]"), uint16(100), uint8(0))
+	f.Add([]byte("5:{}"), uint16(100), uint8(1))
+	f.Add([]byte("2:{}x"), uint16(100), uint8(255))
+	f.Fuzz(func(t *testing.T, data []byte, maxSize uint16, split uint8) {
+		refPackets, refRest, refInvalid := referencePackets(data, int(maxSize))
+		p := NewPacketParser(int(maxSize))
+		packets, err := feedSplit(t, p, data, split)
+		if refInvalid != (err != nil) {
+			t.Fatalf("expected invalid %v, got error %v", refInvalid, err)
+		} else if len(packets) != len(refPackets) {
+			t.Fatalf("expected %v packets, got %v", len(refPackets), len(packets))
+		}
+		for i := range packets {
+			if !bytes.Equal(packets[i], refPackets[i]) {
+				t.Fatalf("packet %v: expected %q, got %q", i, refPackets[i], packets[i])
+			}
+		}
+		if err != nil {
+			// Errors are final
+			if _, againErr := p.Feed([]byte("2:{}")); againErr != err {
+				t.Fatalf("expected same error after failure, got %v", againErr)
+			}
+			return
+		} else if p.Pending() != (len(refRest) > 0) {
+			t.Fatalf("expected pending %v with %q left", len(refRest) > 0, refRest)
+		}
+		// Reframing what was parsed gives the same packets
+		framed := referenceFrame(refPackets)
+		reparsed, err := feedSplit(t, NewPacketParser(int(maxSize)), framed, split>>1)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(reparsed) != len(refPackets) {
+			t.Fatalf("expected %v reparsed packets, got %v", len(refPackets), len(reparsed))
+		}
+		for i := range reparsed {
+			if !bytes.Equal(reparsed[i], refPackets[i]) {
+				t.Fatalf("reparsed packet %v: expected %q, got %q", i, refPackets[i], reparsed[i])
+			}
+		}
+	})
+}
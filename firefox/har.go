@@ -0,0 +1,279 @@
+package firefox
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// StartNetworkCapture starts capturing network requests and their bodies for
+// ExportHAR if not already started. Only the most recent 2000 requests are
+// kept.
+func (t *TabActor) StartNetworkCapture(ctx context.Context) error {
+	m, err := t.getNetworkMonitor(ctx)
+	if err != nil {
+		return err
+	}
+	return m.startCapture(ctx)
+}
+
+// ClearNetworkEvents drops the captured requests. Capture continues if
+// started.
+func (t *TabActor) ClearNetworkEvents() {
+	t.networkLock.Lock()
+	m := t.network
+	t.networkLock.Unlock()
+	if m != nil {
+		m.clear()
+	}
+}
+
+// ExportHAR writes a HAR 1.2 document of every request captured since capture
+// started. Response bodies are included when Firefox still has them.
+func (t *TabActor) ExportHAR(ctx context.Context, w io.Writer) error {
+	t.networkLock.Lock()
+	m := t.network
+	t.networkLock.Unlock()
+	if m == nil {
+		return fmt.Errorf("network capture not started")
+	}
+	// Copy the events under lock
+	m.eventsLock.RLock()
+	if !m.capturing {
+		m.eventsLock.RUnlock()
+		return fmt.Errorf("network capture not started")
+	}
+	events := make([]NetworkEvent, len(m.eventOrder))
+	for i, state := range m.eventOrder {
+		events[i] = state.NetworkEvent
+	}
+	m.eventsLock.RUnlock()
+	// Build the log
+	version := ""
+	if info := t.root.mgr.firefox.ServerInfo; info != nil {
+		version = info.Version
+	}
+	doc := harDoc{Log: harLog{
+		Version: "1.2",
+		Creator: harNameVersion{Name: "ffembedpoc", Version: "0.1"},
+		Browser: &harNameVersion{Name: "Firefox", Version: version},
+		Pages:   []*harPage{},
+		Entries: make([]*harEntry, 0, len(events)),
+	}}
+	if len(events) > 0 {
+		doc.Log.Pages = append(doc.Log.Pages, &harPage{
+			StartedDateTime: harTime(events[0].Started),
+			ID:              t.ID,
+			Title:           t.Title(),
+			PageTimings:     harPageTimings{OnContentLoad: -1, OnLoad: -1},
+		})
+	}
+	for _, ev := range events {
+		entry, err := newHAREntry(ctx, t.ID, &ev)
+		if err != nil {
+			return err
+		}
+		doc.Log.Entries = append(doc.Log.Entries, entry)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func newHAREntry(ctx context.Context, pageRef string, ev *NetworkEvent) (*harEntry, error) {
+	entry := &harEntry{
+		PageRef:         pageRef,
+		StartedDateTime: harTime(ev.Started),
+		Time:            ev.Timings.Total,
+		Request: harRequest{
+			Method:      ev.Method,
+			URL:         ev.URL,
+			HTTPVersion: ev.HTTPVersion,
+			Cookies:     []struct{}{},
+			Headers:     ev.RequestHeaders,
+			QueryString: []NetworkHeader{},
+			HeadersSize: ev.RequestHeadersSize,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			Status:      ev.Status,
+			StatusText:  ev.StatusText,
+			HTTPVersion: ev.HTTPVersion,
+			Cookies:     []struct{}{},
+			Headers:     ev.ResponseHeaders,
+			Content:     harContent{Size: ev.ContentSize, MimeType: ev.MimeType},
+			HeadersSize: ev.ResponseHeadersSize,
+			BodySize:    ev.TransferredSize,
+		},
+		Cache: struct{}{},
+		Timings: harTimings{
+			Blocked: ev.Timings.Blocked,
+			DNS:     ev.Timings.DNS,
+			Connect: ev.Timings.Connect,
+			Send:    ev.Timings.Send,
+			Wait:    ev.Timings.Wait,
+			Receive: ev.Timings.Receive,
+			SSL:     ev.Timings.SSL,
+		},
+		ServerIPAddress: ev.RemoteAddress,
+	}
+	// HAR requires non-null arrays and non-negative send/wait/receive
+	if entry.Request.Headers == nil {
+		entry.Request.Headers = []NetworkHeader{}
+	}
+	if entry.Response.Headers == nil {
+		entry.Response.Headers = []NetworkHeader{}
+	}
+	for _, v := range []*float64{&entry.Timings.Send, &entry.Timings.Wait, &entry.Timings.Receive} {
+		if *v < 0 {
+			*v = 0
+		}
+	}
+	if !ev.Complete {
+		entry.Response.Status = 0
+		entry.Response.BodySize = -1
+		entry.Response.HeadersSize = -1
+		entry.Request.HeadersSize = -1
+	}
+	for _, header := range entry.Response.Headers {
+		if strings.EqualFold(header.Name, "location") {
+			entry.Response.RedirectURL = header.Value
+		}
+	}
+	if u, err := url.Parse(ev.URL); err == nil {
+		entry.Request.QueryString = harQueryString(u.RawQuery)
+	}
+	// Body if available, ignore errors since it's often discarded
+	if ev.Complete {
+		if body, err := ev.ResponseBody(ctx); err == nil && body != nil {
+			if isTextMimeType(ev.MimeType) {
+				entry.Response.Content.Text = string(body)
+			} else {
+				entry.Response.Content.Text = base64.StdEncoding.EncodeToString(body)
+				entry.Response.Content.Encoding = "base64"
+			}
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return entry, nil
+}
+
+// In URL order, which url.Values loses. Undecodable parts are left as is.
+func harQueryString(rawQuery string) []NetworkHeader {
+	params := []NetworkHeader{}
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		param := NetworkHeader{Name: part}
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			param.Name, param.Value = part[:i], part[i+1:]
+		}
+		if name, err := url.QueryUnescape(param.Name); err == nil {
+			param.Name = name
+		}
+		if value, err := url.QueryUnescape(param.Value); err == nil {
+			param.Value = value
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+func isTextMimeType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") || strings.Contains(mimeType, "json") ||
+		strings.Contains(mimeType, "javascript") || strings.Contains(mimeType, "xml")
+}
+
+func harTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+type harDoc struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string          `json:"version"`
+	Creator harNameVersion  `json:"creator"`
+	Browser *harNameVersion `json:"browser,omitempty"`
+	Pages   []*harPage      `json:"pages"`
+	Entries []*harEntry     `json:"entries"`
+}
+
+type harNameVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harPage struct {
+	StartedDateTime string         `json:"startedDateTime"`
+	ID              string         `json:"id"`
+	Title           string         `json:"title"`
+	PageTimings     harPageTimings `json:"pageTimings"`
+}
+
+type harPageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+type harEntry struct {
+	PageRef         string      `json:"pageref,omitempty"`
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+}
+
+type harRequest struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []struct{}      `json:"cookies"`
+	Headers     []NetworkHeader `json:"headers"`
+	QueryString []NetworkHeader `json:"queryString"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int             `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []struct{}      `json:"cookies"`
+	Headers     []NetworkHeader `json:"headers"`
+	Content     harContent      `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
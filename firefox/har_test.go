@@ -0,0 +1,166 @@
+package firefox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestHARQueryString(t *testing.T) {
+	tests := []struct {
+		rawQuery string
+		params   []NetworkHeader
+	}{
+		{"", []NetworkHeader{}},
+		{
+			"z=1&a=2&m=3&a=4",
+			[]NetworkHeader{{"z", "1"}, {"a", "2"}, {"m", "3"}, {"a", "4"}},
+		},
+		{
+			"q=hello+world&empty=&flag&&name%20x=%E2%9C%93",
+			[]NetworkHeader{{"q", "hello world"}, {"empty", ""}, {"flag", ""}, {"name x", "✓"}},
+		},
+		{"bad=%zz&eq=a=b", []NetworkHeader{{"bad", "%zz"}, {"eq", "a=b"}}},
+	}
+	for _, test := range tests {
+		if params := harQueryString(test.rawQuery); !reflect.DeepEqual(params, test.params) {
+			t.Errorf("query %q: expected %v, got %v", test.rawQuery, test.params, params)
+		}
+	}
+}
+
+func TestExportHAR(t *testing.T) {
+	f, s := newTestFirefox(t)
+	beginTestTabs(t, f, s, 1)
+	tab := f.Tabs()[0]
+	if err := tab.ExportHAR(context.Background(), &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error before capture")
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- tab.StartNetworkCapture(context.Background()) }()
+	expectNetworkWatch(s, true)
+	s.send(map[string]interface{}{"from": "watcher1"})
+	s.expect("watcher1", "getNetworkParentActor")
+	s.send(map[string]interface{}{"from": "watcher1", "network": map[string]interface{}{"actor": "network1"}})
+	if packet := s.expect("network1", "setSaveRequestAndResponseBodies"); packet["save"] != true {
+		t.Fatalf("expected bodies saved, got %v", packet)
+	}
+	s.send(map[string]interface{}{"from": "network1"})
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	// Watch to know when events are applied
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	evCh, err := tab.WatchNetwork(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendTestNetworkEvent(s, "netEvent1", "https://example.com/search?z=1&a=2&z=3")
+	sendTestNetworkEvent(s, "netEvent2", "https://example.com/pending")
+	s.send(testNetworkUpdate("netEvent1", map[string]interface{}{
+		"httpVersion": "HTTP/1.1", "status": "302", "statusText": "Found", "mimeType": "text/html",
+		"remoteAddress": "93.184.216.34", "contentSize": 5, "transferredSize": 120, "totalTime": 20,
+		"eventTimingsAvailable": true,
+	}))
+	s.expect("netEvent1", "getRequestHeaders")
+	s.send(map[string]interface{}{"from": "netEvent1"})
+	s.expect("netEvent1", "getResponseHeaders")
+	s.send(map[string]interface{}{
+		"from":        "netEvent1",
+		"headers":     []interface{}{map[string]interface{}{"name": "Location", "value": "/found"}},
+		"headersSize": 25,
+	})
+	s.expect("netEvent1", "getEventTimings")
+	s.send(map[string]interface{}{
+		"from":    "netEvent1",
+		"timings": map[string]interface{}{"blocked": -1, "send": 1, "wait": 15, "receive": 4},
+	})
+	for complete := false; !complete; {
+		complete = nextNetworkEvent(t, evCh).Complete
+	}
+	// Only complete events have bodies
+	buf := &bytes.Buffer{}
+	go func() { errCh <- tab.ExportHAR(context.Background(), buf) }()
+	s.expect("netEvent1", "getResponseContent")
+	s.send(map[string]interface{}{
+		"from":    "netEvent1",
+		"content": map[string]interface{}{"mimeType": "text/html", "text": "hello"},
+	})
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	var doc harDoc
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Log.Pages) != 1 || doc.Log.Pages[0].ID != "tab0" {
+		t.Fatalf("unexpected pages %v", doc.Log.Pages)
+	} else if len(doc.Log.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", len(doc.Log.Entries))
+	}
+	complete, pending := doc.Log.Entries[0], doc.Log.Entries[1]
+	switch {
+	case complete.Request.URL != "https://example.com/search?z=1&a=2&z=3" || complete.PageRef != "tab0":
+		t.Fatalf("unexpected entry %+v", complete)
+	case !reflect.DeepEqual(complete.Request.QueryString, []NetworkHeader{{"z", "1"}, {"a", "2"}, {"z", "3"}}):
+		t.Fatalf("unexpected query string %v", complete.Request.QueryString)
+	case complete.Response.Status != 302 || complete.Response.RedirectURL != "/found" ||
+		complete.Response.HeadersSize != 25 || complete.Response.BodySize != 120:
+		t.Fatalf("unexpected response %+v", complete.Response)
+	case complete.Response.Content != harContent{Size: 5, MimeType: "text/html", Text: "hello"}:
+		t.Fatalf("unexpected content %+v", complete.Response.Content)
+	case complete.Time != 20 || complete.Timings != harTimings{Blocked: -1, DNS: -1, Connect: -1, Send: 1, Wait: 15, Receive: 4, SSL: -1}:
+		t.Fatalf("unexpected timings %v %+v", complete.Time, complete.Timings)
+	case complete.Request.Headers == nil || complete.ServerIPAddress != "93.184.216.34":
+		t.Fatalf("unexpected request %+v", complete.Request)
+	}
+	// Incomplete has unknown sizes and required arrays
+	switch {
+	case pending.Request.URL != "https://example.com/pending" || pending.Response.Status != 0:
+		t.Fatalf("unexpected entry %+v", pending)
+	case pending.Response.BodySize != -1 || pending.Response.HeadersSize != -1 || pending.Request.HeadersSize != -1:
+		t.Fatalf("unexpected sizes %+v", pending)
+	case pending.Request.QueryString == nil || pending.Request.Headers == nil || pending.Response.Headers == nil:
+		t.Fatalf("unexpected null arrays %+v", pending)
+	}
+	// Cleared events aren't exported
+	tab.ClearNetworkEvents()
+	buf.Reset()
+	if err := tab.ExportHAR(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	} else if err = json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	} else if len(doc.Log.Entries) != 0 || len(doc.Log.Pages) != 0 {
+		t.Fatalf("expected empty log, got %+v", doc.Log)
+	}
+}
+
+func sendTestNetworkEvent(s *fakeServer, actor, url string) {
+	s.send(map[string]interface{}{
+		"from": "watcher1",
+		"type": "resource-available-form",
+		"resources": []interface{}{map[string]interface{}{
+			"resourceType":    "network-event",
+			"actor":           actor,
+			"startedDateTime": "2020-09-13T12:26:40.000Z",
+			"url":             url,
+			"method":          "GET",
+			"cause":           map[string]interface{}{"type": "document"},
+		}},
+	})
+}
+
+func testNetworkUpdate(actor string, updates map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"from": "watcher1",
+		"type": "resource-updated-form",
+		"resources": []interface{}{map[string]interface{}{
+			"resourceType":    "network-event",
+			"actor":           actor,
+			"resourceUpdates": updates,
+		}},
+	}
+}
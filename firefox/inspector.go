@@ -0,0 +1,268 @@
+package firefox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// DOMNode is a handle to a node in a tab's document. Handles are released
+// in Firefox when garbage collected, or explicitly via Release. Handles are
+// invalid once the tab navigates.
+type DOMNode struct {
+	// Same as the DOM nodeType, e.g. 1 for element and 3 for text
+	NodeType int
+	NodeName string
+	// Only for text, comment, etc nodes
+	NodeValue  string
+	Attributes []DOMAttribute
+
+	walker          *walker
+	actor           string
+	incompleteValue bool
+	released        bool
+	releaseLock     sync.Mutex
+}
+
+type DOMAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type walker struct {
+	tab       *TabActor
+	actor     string
+	inspector string
+	// The tab's documentGen when created
+	documentGen int
+	// Not released
+	root *DOMNode
+}
+
+type actorNode struct {
+	Actor           string         `json:"actor"`
+	NodeType        int            `json:"nodeType"`
+	NodeName        string         `json:"nodeName"`
+	NodeValue       string         `json:"nodeValue"`
+	IncompleteValue bool           `json:"incompleteValue"`
+	Attrs           []DOMAttribute `json:"attrs"`
+}
+
+type actorNodeList struct {
+	Actor  string `json:"actor"`
+	Length int    `json:"length"`
+}
+
+// QuerySelector returns the first matching node in the document or nil if
+// none match
+func (t *TabActor) QuerySelector(ctx context.Context, css string) (*DOMNode, error) {
+	w, err := t.getDOMWalker(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return w.root.QuerySelector(ctx, css)
+}
+
+// QuerySelectorAll returns all matching nodes in the document
+func (t *TabActor) QuerySelectorAll(ctx context.Context, css string) ([]*DOMNode, error) {
+	w, err := t.getDOMWalker(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return w.root.QuerySelectorAll(ctx, css)
+}
+
+// OuterHTML returns the outer HTML of the document element
+func (t *TabActor) OuterHTML(ctx context.Context) (string, error) {
+	node, err := t.QuerySelector(ctx, ":root")
+	if err != nil {
+		return "", err
+	} else if node == nil {
+		return "", fmt.Errorf("no document element")
+	}
+	defer node.Release()
+	return node.OuterHTML(ctx)
+}
+
+// Gets (creating if necessary) the walker for the current target
+func (t *TabActor) getDOMWalker(ctx context.Context) (*walker, error) {
+	t.fieldsLock.RLock()
+	inspector, documentGen := t.inspectorActor, t.documentGen
+	t.fieldsLock.RUnlock()
+	if inspector == "" {
+		return nil, fmt.Errorf("no inspector actor for tab")
+	}
+	t.walkerLock.Lock()
+	defer t.walkerLock.Unlock()
+	// The root is stale once the tab has loaded another document
+	if t.walker != nil && t.walker.inspector == inspector && t.walker.documentGen == documentGen {
+		return t.walker, nil
+	}
+	reply, err := t.root.mgr.request(ctx, &actorMessage{To: inspector, Type: "getWalker"})
+	if err != nil {
+		return nil, fmt.Errorf("failed getting walker: %w", err)
+	} else if reply.Walker == nil || reply.Walker.Root == nil {
+		return nil, fmt.Errorf("no walker returned")
+	}
+	w := &walker{tab: t, actor: reply.Walker.Actor, inspector: inspector, documentGen: documentGen}
+	w.root = w.newNode(reply.Walker.Root, false)
+	t.walker = w
+	return w, nil
+}
+
+func (w *walker) newNode(n *actorNode, releaseOnGC bool) *DOMNode {
+	node := &DOMNode{
+		NodeType:   n.NodeType,
+		NodeName:   n.NodeName,
+		NodeValue:  n.NodeValue,
+		Attributes: n.Attrs,
+		walker:     w,
+		actor:      n.Actor,
+		// Long values need to be fetched separately
+		incompleteValue: n.IncompleteValue,
+	}
+	if releaseOnGC {
+		runtime.SetFinalizer(node, func(node *DOMNode) { go node.Release() })
+	}
+	return node
+}
+
+func (w *walker) request(ctx context.Context, msg *actorMessage) (*actorMessage, error) {
+	msg.To = w.actor
+	return w.tab.root.mgr.request(ctx, msg)
+}
+
+// Attribute returns the attribute value and whether it's present
+func (d *DOMNode) Attribute(name string) (string, bool) {
+	for _, attr := range d.Attributes {
+		if attr.Name == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// QuerySelector returns the first matching descendant or nil if none match
+func (d *DOMNode) QuerySelector(ctx context.Context, css string) (*DOMNode, error) {
+	reply, err := d.walker.request(ctx, &actorMessage{Type: "querySelector", Node: nodeRef(d.actor), Selector: css})
+	if err != nil {
+		return nil, fmt.Errorf("failed querying selector: %w", err)
+	} else if len(reply.Node) == 0 || string(reply.Node) == "null" {
+		return nil, nil
+	}
+	var n actorNode
+	if err := json.Unmarshal(reply.Node, &n); err != nil {
+		return nil, fmt.Errorf("invalid node: %w", err)
+	}
+	return d.walker.newNode(&n, true), nil
+}
+
+// QuerySelectorAll returns all matching descendants
+func (d *DOMNode) QuerySelectorAll(ctx context.Context, css string) ([]*DOMNode, error) {
+	reply, err := d.walker.request(ctx, &actorMessage{Type: "querySelectorAll", Node: nodeRef(d.actor), Selector: css})
+	if err != nil {
+		return nil, fmt.Errorf("failed querying selector: %w", err)
+	} else if reply.List == nil || reply.List.Length == 0 {
+		return nil, nil
+	}
+	// Get all items then release the list
+	mgr := d.walker.tab.root.mgr
+	defer mgr.send(&actorMessage{To: reply.List.Actor, Type: "release"}, nil)
+	start, end := 0, reply.List.Length
+	items, err := mgr.request(ctx, &actorMessage{To: reply.List.Actor, Type: "items", Start: &start, End: &end})
+	if err != nil {
+		return nil, fmt.Errorf("failed getting items: %w", err)
+	}
+	return d.walker.newNodes(items.Nodes), nil
+}
+
+func (w *walker) newNodes(nodes []*actorNode) []*DOMNode {
+	ret := make([]*DOMNode, len(nodes))
+	for i, n := range nodes {
+		ret[i] = w.newNode(n, true)
+	}
+	return ret
+}
+
+func (d *DOMNode) OuterHTML(ctx context.Context) (string, error) {
+	return d.htmlRequest(ctx, "outerHTML")
+}
+
+func (d *DOMNode) InnerHTML(ctx context.Context) (string, error) {
+	return d.htmlRequest(ctx, "innerHTML")
+}
+
+func (d *DOMNode) htmlRequest(ctx context.Context, typ string) (string, error) {
+	reply, err := d.walker.request(ctx, &actorMessage{Type: typ, Node: nodeRef(d.actor)})
+	if err != nil {
+		return "", fmt.Errorf("failed getting %v: %w", typ, err)
+	}
+	return d.walker.tab.root.mgr.resolveString(ctx, reply.Value)
+}
+
+// Text returns the same as the DOM textContent
+func (d *DOMNode) Text(ctx context.Context) (string, error) {
+	var buf strings.Builder
+	if err := d.writeText(ctx, &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (d *DOMNode) writeText(ctx context.Context, buf *strings.Builder) error {
+	const textNode, cdataNode, commentNode = 3, 4, 8
+	switch d.NodeType {
+	case textNode, cdataNode:
+		if !d.incompleteValue {
+			buf.WriteString(d.NodeValue)
+			return nil
+		}
+		reply, err := d.walker.tab.root.mgr.request(ctx, &actorMessage{To: d.actor, Type: "getNodeValue"})
+		if err != nil {
+			return fmt.Errorf("failed getting node value: %w", err)
+		}
+		value, err := d.walker.tab.root.mgr.resolveString(ctx, reply.Value)
+		buf.WriteString(value)
+		return err
+	case commentNode:
+		return nil
+	}
+	reply, err := d.walker.request(ctx, &actorMessage{Type: "children", Node: nodeRef(d.actor)})
+	if err != nil {
+		return fmt.Errorf("failed getting children: %w", err)
+	}
+	children := d.walker.newNodes(reply.Nodes)
+	defer func() {
+		for _, child := range children {
+			child.Release()
+		}
+	}()
+	for _, child := range children {
+		if err := child.writeText(ctx, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release releases the node in Firefox. This is also done automatically when
+// the node is garbage collected. It is safe to call multiple times.
+func (d *DOMNode) Release() {
+	d.releaseLock.Lock()
+	defer d.releaseLock.Unlock()
+	if d.released {
+		return
+	}
+	d.released = true
+	runtime.SetFinalizer(d, nil)
+	// Ignore errors, the walker may be gone
+	d.walker.tab.root.mgr.send(&actorMessage{To: d.walker.actor, Type: "releaseNode", Node: nodeRef(d.actor)}, nil)
+}
+
+func nodeRef(actor string) json.RawMessage {
+	b, _ := json.Marshal(actor)
+	return b
+}
@@ -0,0 +1,251 @@
+package firefox
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Profile paths and debug ports of instances started in this process, so two
+// can't share either. Firefox would hand the second off to the first or fail
+// on the profile lock, and the PID lookup by port would find the wrong one.
+var claims = struct {
+	sync.Mutex
+	profiles map[string]bool
+	ports    map[int]bool
+}{profiles: map[string]bool{}, ports: map[int]bool{}}
+
+// Paths are case insensitive on Windows
+func profileClaimKey(path string) string {
+	return strings.ToLower(filepath.Clean(path))
+}
+
+func (f *Firefox) claim() error {
+	claims.Lock()
+	defer claims.Unlock()
+	profile := profileClaimKey(f.config.ProfilePath)
+	if claims.profiles[profile] {
+		return fmt.Errorf("profile %v already in use by another instance", f.config.ProfilePath)
+	} else if claims.ports[f.config.DebugPort] {
+		return fmt.Errorf("debug port %v already in use by another instance", f.config.DebugPort)
+	}
+	// Something else, e.g. a Firefox left from a previous run, may have it
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%v", f.config.DebugPort))
+	if err != nil {
+		return fmt.Errorf("debug port %v not available: %w", f.config.DebugPort, err)
+	}
+	l.Close()
+	claims.profiles[profile] = true
+	claims.ports[f.config.DebugPort] = true
+	f.claimed = true
+	return nil
+}
+
+func (f *Firefox) release() {
+	claims.Lock()
+	defer claims.Unlock()
+	if f.claimed {
+		delete(claims.profiles, profileClaimKey(f.config.ProfilePath))
+		delete(claims.ports, f.config.DebugPort)
+		f.claimed = false
+	}
+}
+
+type ManagerConfig struct {
+	// Base for each instance's config. ProfilePath and DebugPort are set per
+	// instance and Log messages are prefixed with the instance name.
+	Instance Config
+	// Default is .profiles in current dir. Each instance's profile is the dir
+	// in here named after it.
+	ProfilesDir string
+}
+
+// Manager runs several Firefox instances in this process, each with its own
+// profile and debug port. For lighter isolation within one instance, see
+// Config.Containers.
+type Manager struct {
+	config ManagerConfig
+	log    Logger
+
+	// Governs fields below it
+	lock sync.Mutex
+	// Nil values are instances still starting
+	instances map[string]*Firefox
+	closed    bool
+}
+
+func NewManager(config ManagerConfig) *Manager {
+	if config.ProfilesDir == "" {
+		config.ProfilesDir = ".profiles"
+	}
+	m := &Manager{config: config, log: config.Instance.Log, instances: map[string]*Firefox{}}
+	if m.log == nil {
+		m.log = zap.S()
+	}
+	return m
+}
+
+// Start starts an instance with the name, which is also its profile dir name.
+// The context is only for startup as with Start.
+func (m *Manager) Start(ctx context.Context, name string) (*Firefox, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid instance name %q", name)
+	}
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return nil, fmt.Errorf("manager closed")
+	} else if _, ok := m.instances[name]; ok {
+		m.lock.Unlock()
+		return nil, fmt.Errorf("instance %v already exists", name)
+	}
+	// Reserve the name while starting
+	m.instances[name] = nil
+	m.lock.Unlock()
+	f, err := m.start(ctx, name)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err != nil {
+		delete(m.instances, name)
+		return nil, err
+	} else if m.closed {
+		// Closed while starting
+		delete(m.instances, name)
+		f.Close()
+		return nil, fmt.Errorf("manager closed")
+	}
+	m.instances[name] = f
+	return f, nil
+}
+
+func (m *Manager) start(ctx context.Context, name string) (*Firefox, error) {
+	config := m.config.Instance
+	config.ProfilePath = filepath.Join(m.config.ProfilesDir, name)
+	config.Log = &prefixLogger{m.log, "[" + strings.ReplaceAll(name, "%", "%%") + "] "}
+	port, err := freeLocalPort()
+	if err != nil {
+		return nil, err
+	}
+	config.DebugPort = port
+	return Start(ctx, config)
+}
+
+// Another process could take the port before Firefox does, in which case
+// Start fails
+func freeLocalPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed finding free port: %w", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Get is the started instance with the name or nil if none
+func (m *Manager) Get(name string) *Firefox {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.instances[name]
+}
+
+// Names of started instances, sorted
+func (m *Manager) Names() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	names := make([]string, 0, len(m.instances))
+	for name, f := range m.instances {
+		if f != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close closes the started instance with the name and removes it. Its
+// profile is kept.
+func (m *Manager) Close(name string) error {
+	m.lock.Lock()
+	f := m.instances[name]
+	if f == nil {
+		m.lock.Unlock()
+		return fmt.Errorf("no started instance %v", name)
+	}
+	delete(m.instances, name)
+	m.lock.Unlock()
+	return f.Close()
+}
+
+// CloseAll closes every instance concurrently and stops new ones from
+// starting. All are closed even on failure, the first error is returned and
+// the rest logged.
+func (m *Manager) CloseAll() error {
+	return m.endAll("closing", func(f *Firefox) error { return f.Close() })
+}
+
+// ShutdownAll is CloseAll but with each instance ended by Firefox.Shutdown
+// with the context
+func (m *Manager) ShutdownAll(ctx context.Context) error {
+	return m.endAll("shutting down", func(f *Firefox) error {
+		method, err := f.Shutdown(ctx)
+		if err == nil {
+			f.log.Infof("Shut down by %v", method)
+		}
+		return err
+	})
+}
+
+func (m *Manager) endAll(desc string, end func(*Firefox) error) error {
+	m.lock.Lock()
+	m.closed = true
+	instances := m.instances
+	m.instances = map[string]*Firefox{}
+	m.lock.Unlock()
+	var wg sync.WaitGroup
+	var errsLock sync.Mutex
+	var firstErr error
+	for name, f := range instances {
+		// Nil while starting, Start closes those
+		if f == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, f *Firefox) {
+			defer wg.Done()
+			if err := end(f); err != nil {
+				errsLock.Lock()
+				defer errsLock.Unlock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed %v %v: %w", desc, name, err)
+				} else {
+					m.log.Errorf("Failed %v %v: %v", desc, name, err)
+				}
+			}
+		}(name, f)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+type prefixLogger struct {
+	Logger
+	prefix string
+}
+
+func (p *prefixLogger) Debugf(format string, args ...interface{}) {
+	p.Logger.Debugf(p.prefix+format, args...)
+}
+
+func (p *prefixLogger) Infof(format string, args ...interface{}) {
+	p.Logger.Infof(p.prefix+format, args...)
+}
+
+func (p *prefixLogger) Errorf(format string, args ...interface{}) {
+	p.Logger.Errorf(p.prefix+format, args...)
+}
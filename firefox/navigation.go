@@ -0,0 +1,199 @@
+package firefox
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Transition is how a navigation was started. Values are stable for
+// persistence, new ones are only appended.
+type Transition int
+
+const (
+	// Started by the page, e.g. a link, script, or redirect
+	TransitionLink Transition = iota
+	// Started by NavigateTo
+	TransitionTyped
+	TransitionBackForward
+	TransitionReload
+)
+
+func (t Transition) String() string {
+	switch t {
+	case TransitionLink:
+		return "link"
+	case TransitionTyped:
+		return "typed"
+	case TransitionBackForward:
+		return "back_forward"
+	case TransitionReload:
+		return "reload"
+	default:
+		return fmt.Sprintf("Transition(%d)", int(t))
+	}
+}
+
+// LastTransition is how the last completed navigation was started
+func (t *TabActor) LastTransition() Transition {
+	t.fieldsLock.RLock()
+	defer t.fieldsLock.RUnlock()
+	return t.lastTransition
+}
+
+// Loads is the number of navigations that have stopped in the tab, including
+// reloads
+func (t *TabActor) Loads() int {
+	t.fieldsLock.RLock()
+	defer t.fieldsLock.RUnlock()
+	return t.documentGen
+}
+
+// GoBack navigates back in the tab's session history
+func (t *TabActor) GoBack(ctx context.Context) error {
+	return t.moveHistory(ctx, -1, "history.back()")
+}
+
+// GoForward navigates forward in the tab's session history
+func (t *TabActor) GoForward(ctx context.Context) error {
+	return t.moveHistory(ctx, 1, "history.forward()")
+}
+
+func (t *TabActor) moveHistory(ctx context.Context, move int, js string) error {
+	t.fieldsLock.Lock()
+	t.historyMove = move
+	t.fieldsLock.Unlock()
+	if _, err := t.Evaluate(ctx, js); err != nil {
+		t.fieldsLock.Lock()
+		t.historyMove = 0
+		t.fieldsLock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Reload reloads the page, bypassing the cache if force is true
+func (t *TabActor) Reload(ctx context.Context, force bool) error {
+	t.fieldsLock.RLock()
+	frameID := t.frameID
+	t.fieldsLock.RUnlock()
+	if frameID == "" {
+		return fmt.Errorf("tab has no target to reload")
+	}
+	_, err := t.root.mgr.request(ctx, &actorMessage{
+		To:      frameID,
+		Type:    "reload",
+		Options: map[string]interface{}{"force": force},
+	})
+	if err != nil {
+		return fmt.Errorf("failed reloading: %w", err)
+	}
+	return nil
+}
+
+// Stop stops loading the page
+func (t *TabActor) Stop(ctx context.Context) error {
+	_, err := t.Evaluate(ctx, "window.stop()")
+	return err
+}
+
+// CanGoBack is true if there is history to go back to. This is from the
+// browser's session history as of the last navigation stop. Until that is
+// loaded or if it can't be, history is tracked from navigations seen since the
+// tab was first seen, so it may not include earlier entries.
+func (t *TabActor) CanGoBack() bool {
+	t.fieldsLock.RLock()
+	defer t.fieldsLock.RUnlock()
+	if t.sessionHistoryKnown {
+		return t.canGoBack
+	}
+	return t.historyIndex > 0
+}
+
+// CanGoForward is true if there is history to go forward to. See CanGoBack.
+func (t *TabActor) CanGoForward() bool {
+	t.fieldsLock.RLock()
+	defer t.fieldsLock.RUnlock()
+	if t.sessionHistoryKnown {
+		return t.canGoForward
+	}
+	return t.historyIndex < len(t.history)-1
+}
+
+// Timeout for loading session history after a navigation
+const sessionHistoryTimeout = 10 * time.Second
+
+// Called with the fields lock held on navigation stop. Loads whether the
+// tab's browser can go back or forward in the background, firing the state
+// listener if changed.
+func (t *TabActor) loadSessionHistoryUnlocked() {
+	documentGen, browserID, outerWindowID := t.documentGen, t.browserID, t.outerWindowID
+	if browserID == 0 && outerWindowID == 0 {
+		return
+	}
+	js := fmt.Sprintf(`(() => {
+  const browser = %v.browsers.find(b => %d ? b.browserId === %d : b.outerWindowID === %d);
+  if (!browser) throw new Error("tab browser not found");
+  return JSON.stringify({ canGoBack: browser.canGoBack, canGoForward: browser.canGoForward });
+})()`, chromeGBrowserJS, browserID, browserID, outerWindowID)
+	go func() {
+		f := t.root.mgr.firefox
+		ctx, cancel := context.WithTimeout(t.ctx, sessionHistoryTimeout)
+		defer cancel()
+		var history struct {
+			CanGoBack    bool `json:"canGoBack"`
+			CanGoForward bool `json:"canGoForward"`
+		}
+		// Chrome evaluation may be disabled, which the tracked history covers
+		if err := f.EvaluateChromeJSON(ctx, js, &history); err != nil {
+			f.log.Debugf("Failed loading session history for %v: %v", t.ID, err)
+			return
+		}
+		t.fieldsLock.Lock()
+		defer t.fieldsLock.Unlock()
+		// A later navigation loads its own
+		if t.documentGen != documentGen {
+			return
+		}
+		changed := !t.sessionHistoryKnown || t.canGoBack != history.CanGoBack ||
+			t.canGoForward != history.CanGoForward
+		t.sessionHistoryKnown, t.canGoBack, t.canGoForward = true, history.CanGoBack, history.CanGoForward
+		if changed {
+			t.StateChangedListener.Fire()
+		}
+	}()
+}
+
+// Called on navigation stop. Moves requested by GoBack/GoForward are applied,
+// otherwise a URL matching an adjacent entry is assumed to be a move made in
+// the page (e.g. Alt+Left) unless NavigateTo started it, a URL matching the
+// current entry is a reload, and anything else is a new entry replacing
+// forward history. Also sets the last transition.
+func (t *TabActor) recordHistoryUnlocked(url string) {
+	move, typed := t.historyMove, t.navigateToPending
+	t.historyMove, t.navigateToPending = 0, false
+	t.lastTransition = TransitionLink
+	if typed {
+		t.lastTransition = TransitionTyped
+	}
+	switch {
+	case url == "":
+	case len(t.history) == 0:
+		t.history, t.historyIndex = []string{url}, 0
+	case move != 0 && t.historyIndex+move >= 0 && t.historyIndex+move < len(t.history):
+		t.historyIndex += move
+		t.history[t.historyIndex] = url
+		t.lastTransition = TransitionBackForward
+	case t.history[t.historyIndex] == url:
+		t.lastTransition = TransitionReload
+	case !typed && t.historyIndex > 0 && t.history[t.historyIndex-1] == url:
+		t.historyIndex--
+		t.lastTransition = TransitionBackForward
+	case !typed && t.historyIndex < len(t.history)-1 && t.history[t.historyIndex+1] == url:
+		t.historyIndex++
+		t.lastTransition = TransitionBackForward
+	default:
+		t.history = append(t.history[:t.historyIndex+1], url)
+		t.historyIndex++
+	}
+}
@@ -0,0 +1,409 @@
+package firefox
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NetworkEvent is a snapshot of a network request. The same request is sent
+// to watchers multiple times as it progresses, ending with Complete set.
+type NetworkEvent struct {
+	// Unique within the tab
+	ID        string
+	URL       string
+	Method    string
+	Started   time.Time
+	IsXHR     bool
+	FromCache bool
+	// E.g. "document", "img", "script", etc
+	Cause string
+
+	// Set once the response starts
+	HTTPVersion     string
+	Status          int
+	StatusText      string
+	MimeType        string
+	RemoteAddress   string
+	RemotePort      int
+	ContentSize     int64
+	TransferredSize int64
+
+	// Set once complete
+	Complete            bool
+	RequestHeaders      []NetworkHeader
+	RequestHeadersSize  int64
+	ResponseHeaders     []NetworkHeader
+	ResponseHeadersSize int64
+	Timings             NetworkTimings
+
+	tab   *TabActor
+	actor string
+}
+
+type NetworkHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// NetworkTimings are in milliseconds, -1 if not applicable. They mirror the
+// HAR timings.
+type NetworkTimings struct {
+	Blocked float64
+	DNS     float64
+	Connect float64
+	SSL     float64
+	Send    float64
+	Wait    float64
+	Receive float64
+	Total   float64
+}
+
+// ResponseBody fetches the response body. This only works when Complete is
+// set, network capture was started before the request, and while the event is
+// still held by Firefox.
+func (n *NetworkEvent) ResponseBody(ctx context.Context) ([]byte, error) {
+	reply, err := n.tab.root.mgr.request(ctx, &actorMessage{To: n.actor, Type: "getResponseContent"})
+	if err != nil {
+		return nil, fmt.Errorf("failed getting response content: %w", err)
+	} else if reply.Content == nil || len(reply.Content.Text) == 0 {
+		return nil, nil
+	}
+	text, err := n.tab.root.mgr.resolveString(ctx, reply.Content.Text)
+	if err != nil {
+		return nil, err
+	} else if reply.Content.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
+
+// WatchNetwork starts watching network requests if not already started and
+// sends events to the returned channel until the context is done at which
+// point the channel is closed. Only requests started after the first call are
+// seen. Events are dropped for readers that fall behind. Watching alone does
+// not keep events or bodies, see StartNetworkCapture.
+func (t *TabActor) WatchNetwork(ctx context.Context) (<-chan NetworkEvent, error) {
+	m, err := t.getNetworkMonitor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan NetworkEvent, 100)
+	m.subsLock.Lock()
+	m.subs[ch] = struct{}{}
+	m.subsLock.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.subsLock.Lock()
+		defer m.subsLock.Unlock()
+		delete(m.subs, ch)
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// Most captured events kept, older ones are dropped
+const maxCapturedNetworkEvents = 2000
+
+type networkMonitor struct {
+	tab *TabActor
+
+	// Governs fields below it
+	eventsLock sync.RWMutex
+	// Incomplete events and captured ones
+	events    map[string]*networkEventState
+	capturing bool
+	// Captured events in the order started
+	eventOrder []*networkEventState
+
+	subs     map[chan<- NetworkEvent]struct{}
+	subsLock sync.RWMutex
+
+	// Populated by onResource, drained by run
+	queue     []*actorResource
+	queueLock sync.Mutex
+	queueCh   chan struct{}
+}
+
+type networkEventState struct {
+	NetworkEvent
+	updates actorNetworkUpdates
+	// True while in eventOrder
+	captured bool
+}
+
+type actorNetworkResource struct {
+	StartedDateTime string `json:"startedDateTime"`
+	URL             string `json:"url"`
+	Method          string `json:"method"`
+	IsXHR           bool   `json:"isXHR"`
+	FromCache       bool   `json:"fromCache"`
+	Cause           struct {
+		Type string `json:"type"`
+	} `json:"cause"`
+}
+
+// Updates are merged in as they arrive
+type actorNetworkUpdates struct {
+	HTTPVersion           string          `json:"httpVersion"`
+	Status                json.RawMessage `json:"status"`
+	StatusText            string          `json:"statusText"`
+	MimeType              string          `json:"mimeType"`
+	RemoteAddress         string          `json:"remoteAddress"`
+	RemotePort            int             `json:"remotePort"`
+	ContentSize           int64           `json:"contentSize"`
+	TransferredSize       int64           `json:"transferredSize"`
+	TotalTime             float64         `json:"totalTime"`
+	EventTimingsAvailable bool            `json:"eventTimingsAvailable"`
+}
+
+func (t *TabActor) getNetworkMonitor(ctx context.Context) (*networkMonitor, error) {
+	t.networkLock.Lock()
+	defer t.networkLock.Unlock()
+	if t.network != nil {
+		return t.network, nil
+	}
+	w, err := t.getWatcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := &networkMonitor{
+		tab:     t,
+		events:  map[string]*networkEventState{},
+		subs:    map[chan<- NetworkEvent]struct{}{},
+		queueCh: make(chan struct{}, 1),
+	}
+	// Firefox keeps bodies by default, only wanted while capturing
+	if err := m.saveBodies(ctx, false); err != nil {
+		t.root.mgr.firefox.log.Errorf("Failed disabling network body saving: %v", err)
+	}
+	// Resources before run starts are queued
+	if err := w.watchResource(ctx, "network-event", m.onResource); err != nil {
+		return nil, err
+	}
+	go m.run(t.ctx)
+	t.network = m
+	return m, nil
+}
+
+// Sets whether Firefox keeps request and response bodies for new requests
+func (n *networkMonitor) saveBodies(ctx context.Context, save bool) error {
+	mgr := n.tab.root.mgr
+	w, err := n.tab.getWatcher(ctx)
+	if err != nil {
+		return err
+	}
+	reply, err := mgr.request(ctx, &actorMessage{To: w.id, Type: "getNetworkParentActor"})
+	if err != nil {
+		return fmt.Errorf("failed getting network parent: %w", err)
+	}
+	var parent struct {
+		Network *actorFrame `json:"network"`
+	}
+	if err := json.Unmarshal(reply.raw, &parent); err != nil {
+		return fmt.Errorf("invalid network parent: %w", err)
+	} else if parent.Network == nil || parent.Network.Actor == "" {
+		return fmt.Errorf("no network parent")
+	}
+	packet := map[string]interface{}{
+		"to":   parent.Network.Actor,
+		"type": "setSaveRequestAndResponseBodies",
+		"save": save,
+	}
+	if _, err := mgr.requestPacket(ctx, parent.Network.Actor, packet, false); err != nil {
+		return fmt.Errorf("failed setting body saving: %w", err)
+	}
+	return nil
+}
+
+func (n *networkMonitor) startCapture(ctx context.Context) error {
+	n.eventsLock.Lock()
+	alreadyCapturing := n.capturing
+	n.capturing = true
+	n.eventsLock.Unlock()
+	if alreadyCapturing {
+		return nil
+	}
+	// Capture still works without bodies
+	if err := n.saveBodies(ctx, true); err != nil {
+		n.tab.root.mgr.firefox.log.Errorf("Failed enabling network body saving: %v", err)
+	}
+	return nil
+}
+
+// Called with the events lock held
+func (n *networkMonitor) uncaptureUnlocked(state *networkEventState) {
+	state.captured = false
+	// Incomplete ones are still needed for updates
+	if state.Complete {
+		delete(n.events, state.ID)
+	}
+}
+
+func (n *networkMonitor) clear() {
+	n.eventsLock.Lock()
+	defer n.eventsLock.Unlock()
+	for _, state := range n.eventOrder {
+		n.uncaptureUnlocked(state)
+	}
+	n.eventOrder = nil
+}
+
+// Called on the watcher dispatch goroutine and requests would block other
+// resources, so just queue
+func (n *networkMonitor) onResource(res *actorResource, updated bool) {
+	if !updated && res.Actor == "" {
+		return
+	}
+	n.queueLock.Lock()
+	n.queue = append(n.queue, res)
+	n.queueLock.Unlock()
+	select {
+	case n.queueCh <- struct{}{}:
+	default:
+	}
+}
+
+func (n *networkMonitor) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.queueCh:
+		}
+		n.queueLock.Lock()
+		queue := n.queue
+		n.queue = nil
+		n.queueLock.Unlock()
+		for _, res := range queue {
+			if ev := n.apply(ctx, res); ev != nil {
+				n.broadcast(*ev)
+			}
+		}
+	}
+}
+
+// Returns the snapshot to broadcast or nil if nothing to broadcast
+func (n *networkMonitor) apply(ctx context.Context, res *actorResource) *NetworkEvent {
+	log := n.tab.root.mgr.firefox.log
+	// New events just get added
+	if len(res.ResourceUpdates) == 0 {
+		var netRes actorNetworkResource
+		if err := json.Unmarshal(res.raw, &netRes); err != nil {
+			log.Errorf("Invalid network event: %v", err)
+			return nil
+		}
+		state := &networkEventState{NetworkEvent: NetworkEvent{
+			ID:        res.id(),
+			URL:       netRes.URL,
+			Method:    netRes.Method,
+			IsXHR:     netRes.IsXHR,
+			FromCache: netRes.FromCache,
+			Cause:     netRes.Cause.Type,
+			tab:       n.tab,
+			actor:     res.Actor,
+		}}
+		state.Started, _ = time.Parse(time.RFC3339Nano, netRes.StartedDateTime)
+		n.eventsLock.Lock()
+		n.events[state.ID] = state
+		if n.capturing {
+			state.captured = true
+			n.eventOrder = append(n.eventOrder, state)
+			if len(n.eventOrder) > maxCapturedNetworkEvents {
+				n.uncaptureUnlocked(n.eventOrder[0])
+				n.eventOrder[0] = nil
+				n.eventOrder = n.eventOrder[1:]
+			}
+		}
+		n.eventsLock.Unlock()
+		ev := state.NetworkEvent
+		return &ev
+	}
+	// Otherwise, update the existing
+	n.eventsLock.RLock()
+	state := n.events[res.id()]
+	n.eventsLock.RUnlock()
+	if state == nil {
+		return nil
+	}
+	// Only this goroutine mutates, but the lock is for readers
+	updates := state.updates
+	if err := json.Unmarshal(res.ResourceUpdates, &updates); err != nil {
+		log.Errorf("Invalid network event update: %v", err)
+		return nil
+	}
+	ev := state.NetworkEvent
+	ev.HTTPVersion = updates.HTTPVersion
+	ev.Status, _ = strconv.Atoi(strings.Trim(string(updates.Status), `"`))
+	ev.StatusText = updates.StatusText
+	ev.MimeType = updates.MimeType
+	ev.RemoteAddress = updates.RemoteAddress
+	ev.RemotePort = updates.RemotePort
+	ev.ContentSize = updates.ContentSize
+	ev.TransferredSize = updates.TransferredSize
+	// Timings are the last to be available, so grab the rest when they are
+	if updates.EventTimingsAvailable && !ev.Complete {
+		if err := n.loadDetails(ctx, &ev); err != nil {
+			log.Errorf("Failed loading details for %v: %v", ev.URL, err)
+		}
+		ev.Timings.Total = updates.TotalTime
+		ev.Complete = true
+	}
+	n.eventsLock.Lock()
+	state.updates = updates
+	state.NetworkEvent = ev
+	// Only captured events are kept once complete
+	if ev.Complete && !state.captured {
+		delete(n.events, state.ID)
+	}
+	n.eventsLock.Unlock()
+	return &ev
+}
+
+func (n *networkMonitor) loadDetails(ctx context.Context, ev *NetworkEvent) error {
+	mgr := n.tab.root.mgr
+	reply, err := mgr.request(ctx, &actorMessage{To: ev.actor, Type: "getRequestHeaders"})
+	if err != nil {
+		return fmt.Errorf("failed getting request headers: %w", err)
+	}
+	ev.RequestHeaders, ev.RequestHeadersSize = reply.Headers, reply.HeadersSize
+	if reply, err = mgr.request(ctx, &actorMessage{To: ev.actor, Type: "getResponseHeaders"}); err != nil {
+		return fmt.Errorf("failed getting response headers: %w", err)
+	}
+	ev.ResponseHeaders, ev.ResponseHeadersSize = reply.Headers, reply.HeadersSize
+	if reply, err = mgr.request(ctx, &actorMessage{To: ev.actor, Type: "getEventTimings"}); err != nil {
+		return fmt.Errorf("failed getting timings: %w", err)
+	}
+	timing := func(name string) float64 {
+		if v, ok := reply.Timings[name]; ok {
+			return v
+		}
+		return -1
+	}
+	ev.Timings = NetworkTimings{
+		Blocked: timing("blocked"),
+		DNS:     timing("dns"),
+		Connect: timing("connect"),
+		SSL:     timing("ssl"),
+		Send:    timing("send"),
+		Wait:    timing("wait"),
+		Receive: timing("receive"),
+	}
+	return nil
+}
+
+func (n *networkMonitor) broadcast(ev NetworkEvent) {
+	n.subsLock.RLock()
+	defer n.subsLock.RUnlock()
+	for ch := range n.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package firefox
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type watchNetworkResult struct {
+	ch  <-chan NetworkEvent
+	err error
+}
+
+func watchNetworkAsync(ctx context.Context, tab *TabActor) <-chan watchNetworkResult {
+	resultCh := make(chan watchNetworkResult, 1)
+	go func() {
+		ch, err := tab.WatchNetwork(ctx)
+		resultCh <- watchNetworkResult{ch, err}
+	}()
+	return resultCh
+}
+
+// Answers the requests of the first network watch up to watching resources
+func expectNetworkWatch(s *fakeServer, getWatcher bool) map[string]interface{} {
+	if getWatcher {
+		s.expect("tab0", "getWatcher")
+		s.send(map[string]interface{}{"from": "tab0", "actor": "watcher1"})
+	}
+	s.expect("watcher1", "getNetworkParentActor")
+	s.send(map[string]interface{}{"from": "watcher1", "network": map[string]interface{}{"actor": "network1"}})
+	if packet := s.expect("network1", "setSaveRequestAndResponseBodies"); packet["save"] != false {
+		s.tb.Fatalf("expected bodies not saved, got %v", packet)
+	}
+	s.send(map[string]interface{}{"from": "network1"})
+	packet := s.expect("watcher1", "watchResources")
+	if types, _ := packet["resourceTypes"].([]interface{}); len(types) != 1 || types[0] != "network-event" {
+		s.tb.Fatalf("unexpected resource types %v", packet["resourceTypes"])
+	}
+	return packet
+}
+
+func nextNetworkEvent(t *testing.T, ch <-chan NetworkEvent) NetworkEvent {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for network event")
+	}
+	return NetworkEvent{}
+}
+
+func TestWatchNetwork(t *testing.T) {
+	f, s := newTestFirefox(t)
+	beginTestTabs(t, f, s, 1)
+	tab := f.Tabs()[0]
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resultCh := watchNetworkAsync(ctx, tab)
+	expectNetworkWatch(s, true)
+	s.send(map[string]interface{}{"from": "watcher1"})
+	res := <-resultCh
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	// New, then response started, then timings which complete it
+	s.send(map[string]interface{}{
+		"from": "watcher1",
+		"type": "resources-available-array",
+		"array": []interface{}{[]interface{}{"network-event", []interface{}{map[string]interface{}{
+			"resourceType":    "network-event",
+			"actor":           "netEvent1",
+			"startedDateTime": "2020-09-13T12:26:40.000Z",
+			"url":             "https://example.com/",
+			"method":          "GET",
+			"isXHR":           false,
+			"fromCache":       false,
+			"cause":           map[string]interface{}{"type": "document"},
+		}}}},
+	})
+	ev := nextNetworkEvent(t, res.ch)
+	if ev.ID != "netEvent1" || ev.URL != "https://example.com/" || ev.Method != "GET" ||
+		ev.Cause != "document" || ev.Complete {
+		t.Fatalf("unexpected new event %+v", ev)
+	} else if !ev.Started.Equal(time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)) {
+		t.Fatalf("unexpected start %v", ev.Started)
+	}
+	updated := func(updates map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"from": "watcher1",
+			"type": "resources-updated-array",
+			"array": []interface{}{[]interface{}{"network-event", []interface{}{map[string]interface{}{
+				"resourceType":    "network-event",
+				"actor":           "netEvent1",
+				"resourceUpdates": updates,
+			}}}},
+		}
+	}
+	s.send(updated(map[string]interface{}{
+		"httpVersion": "HTTP/2", "status": "200", "statusText": "OK", "mimeType": "text/html",
+		"remoteAddress": "93.184.216.34", "remotePort": 443,
+	}))
+	ev = nextNetworkEvent(t, res.ch)
+	if ev.Status != 200 || ev.HTTPVersion != "HTTP/2" || ev.RemotePort != 443 || ev.Complete {
+		t.Fatalf("unexpected response event %+v", ev)
+	}
+	// Earlier updates are kept
+	s.send(updated(map[string]interface{}{
+		"contentSize": 1256, "transferredSize": 800, "totalTime": 52.5, "eventTimingsAvailable": true,
+	}))
+	s.expect("netEvent1", "getRequestHeaders")
+	s.send(map[string]interface{}{
+		"from":        "netEvent1",
+		"headers":     []interface{}{map[string]interface{}{"name": "Host", "value": "example.com"}},
+		"headersSize": 30,
+	})
+	s.expect("netEvent1", "getResponseHeaders")
+	s.send(map[string]interface{}{
+		"from":        "netEvent1",
+		"headers":     []interface{}{map[string]interface{}{"name": "Content-Type", "value": "text/html"}},
+		"headersSize": 40,
+	})
+	s.expect("netEvent1", "getEventTimings")
+	s.send(map[string]interface{}{
+		"from":    "netEvent1",
+		"timings": map[string]interface{}{"blocked": 1, "dns": 2, "connect": 3, "send": 4, "wait": 30, "receive": 12.5},
+	})
+	ev = nextNetworkEvent(t, res.ch)
+	switch {
+	case !ev.Complete:
+		t.Fatalf("expected complete event %+v", ev)
+	case ev.Status != 200 || ev.ContentSize != 1256 || ev.TransferredSize != 800:
+		t.Fatalf("unexpected complete event %+v", ev)
+	case len(ev.RequestHeaders) != 1 || ev.RequestHeaders[0].Value != "example.com" || ev.RequestHeadersSize != 30:
+		t.Fatalf("unexpected request headers %v", ev.RequestHeaders)
+	case len(ev.ResponseHeaders) != 1 || ev.ResponseHeaders[0].Name != "Content-Type" || ev.ResponseHeadersSize != 40:
+		t.Fatalf("unexpected response headers %v", ev.ResponseHeaders)
+	case ev.Timings != NetworkTimings{Blocked: 1, DNS: 2, Connect: 3, SSL: -1, Send: 4, Wait: 30, Receive: 12.5, Total: 52.5}:
+		t.Fatalf("unexpected timings %+v", ev.Timings)
+	}
+	// Not captured, so not kept once complete
+	tab.network.eventsLock.RLock()
+	defer tab.network.eventsLock.RUnlock()
+	if len(tab.network.events) != 0 {
+		t.Fatalf("expected no events kept, got %v", len(tab.network.events))
+	}
+}
+
+func TestWatchNetworkFailed(t *testing.T) {
+	f, s := newTestFirefox(t)
+	beginTestTabs(t, f, s, 1)
+	tab := f.Tabs()[0]
+	resultCh := watchNetworkAsync(context.Background(), tab)
+	expectNetworkWatch(s, true)
+	s.send(map[string]interface{}{"from": "watcher1", "error": "unknownError", "message": "nope"})
+	if res := <-resultCh; res.err == nil {
+		t.Fatal("expected watch error")
+	}
+	tab.networkLock.Lock()
+	network := tab.network
+	tab.networkLock.Unlock()
+	if network != nil {
+		t.Fatal("monitor kept after failed watch")
+	}
+	// The watcher is reused and watching is tried again
+	resultCh = watchNetworkAsync(context.Background(), tab)
+	expectNetworkWatch(s, false)
+	s.send(map[string]interface{}{"from": "watcher1"})
+	if res := <-resultCh; res.err != nil {
+		t.Fatal(res.err)
+	}
+}
+
+func TestWatchNetworkTabClosed(t *testing.T) {
+	f, s := newTestFirefox(t)
+	beginTestTabs(t, f, s, 1)
+	tab := f.Tabs()[0]
+	resultCh := watchNetworkAsync(context.Background(), tab)
+	expectNetworkWatch(s, true)
+	s.send(map[string]interface{}{"from": "watcher1"})
+	res := <-resultCh
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	hasWatcher := func() bool {
+		f.mgr.actorsLock.RLock()
+		defer f.mgr.actorsLock.RUnlock()
+		_, ok := f.mgr.actors["watcher1"]
+		return ok
+	}
+	if !hasWatcher() {
+		t.Fatal("watcher not registered")
+	}
+	s.send(map[string]interface{}{"from": "tab0", "type": "tabDetached"})
+	<-tab.Done()
+	waitFor(t, "watcher removal", func() bool { return !hasWatcher() })
+}
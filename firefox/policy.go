@@ -0,0 +1,248 @@
+package firefox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// NavigationPolicy limits which URLs tabs can navigate to. A URL is allowed if
+// it matches no Deny rule and, when there are Allow rules, matches one of
+// them. The about:blank URL is always allowed.
+type NavigationPolicy struct {
+	Allow []NavigationRule
+	Deny  []NavigationRule
+	// Default is to stop blocked navigations as they start and to send tabs
+	// that still load a blocked URL to about:blank. If set, blocked navigations
+	// are sent here instead. It must be allowed.
+	RedirectURL string
+	// Default is only client-side enforcement. If true, the rules are also
+	// written as the WebsiteFilter enterprise policy in
+	// distribution/policies.json beside the Firefox executable. That applies to
+	// every profile using that Firefox install, needs write access to its dir,
+	// and is not removed when this is unset. Regexp rules and Deny rules inside
+	// allowed sites can't be expressed there. Failure is logged, not fatal.
+	EnterprisePolicy bool
+	// Default is no callback. Called on its own goroutine for each blocked
+	// navigation.
+	OnBlocked func(BlockedNavigation)
+}
+
+// NavigationRule matches a URL if every set field matches. A rule with no
+// fields set matches every URL.
+type NavigationRule struct {
+	// Glob for the host as in path.Match, case insensitive. A glob starting
+	// with "*." also matches the domain itself, e.g. "*.example.com" matches
+	// "example.com".
+	Host string
+	// Without the colon, e.g. "https"
+	Scheme string
+	// Matched against the whole URL
+	Regexp *regexp.Regexp
+}
+
+// BlockedNavigation is a navigation stopped or redirected by the policy or by
+// kiosk mode
+type BlockedNavigation struct {
+	Tab *TabActor
+	URL string
+	// Where the tab was sent, empty if the navigation was only stopped
+	RedirectURL string
+}
+
+// Allowed is true if the policy allows navigating to the URL
+func (p *NavigationPolicy) Allowed(rawURL string) bool {
+	if rawURL == "about:blank" {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, rule := range p.Deny {
+		if rule.matches(rawURL, u) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, rule := range p.Allow {
+		if rule.matches(rawURL, u) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *NavigationRule) matches(rawURL string, u *url.URL) bool {
+	if n.Scheme != "" && !strings.EqualFold(n.Scheme, u.Scheme) {
+		return false
+	}
+	if n.Host != "" && !hostGlobMatches(strings.ToLower(n.Host), strings.ToLower(u.Hostname())) {
+		return false
+	}
+	return n.Regexp == nil || n.Regexp.MatchString(rawURL)
+}
+
+func hostGlobMatches(glob, host string) bool {
+	if strings.HasPrefix(glob, "*.") && host == glob[2:] {
+		return true
+	}
+	matched, _ := path.Match(glob, host)
+	return matched
+}
+
+// Schemes for browser internals and local files
+var kioskBlockedSchemes = map[string]bool{
+	"about": true, "chrome": true, "resource": true, "view-source": true,
+	"moz-extension": true, "jar": true, "file": true, "javascript": true,
+}
+
+var kioskAllowedAboutPages = map[string]bool{"about:blank": true, "about:home": true, "about:newtab": true}
+
+func kioskAllowed(rawURL string) bool {
+	scheme := rawURL
+	if i := strings.Index(rawURL, ":"); i >= 0 {
+		scheme = rawURL[:i]
+	}
+	return !kioskBlockedSchemes[strings.ToLower(scheme)] || kioskAllowedAboutPages[rawURL]
+}
+
+// Called with the fields lock held on navigation start and stop. True if the
+// URL is blocked by the policy or kiosk mode, in which case the navigation has
+// been stopped or redirected.
+func (t *TabActor) enforcePolicyUnlocked(state, url string) bool {
+	f := t.root.mgr.firefox
+	policy := f.config.NavigationPolicy
+	if url == "" || ((!f.config.Kiosk || kioskAllowed(url)) && (policy == nil || policy.Allowed(url))) {
+		return false
+	}
+	blocked := BlockedNavigation{Tab: t, URL: url}
+	if policy != nil {
+		blocked.RedirectURL = policy.RedirectURL
+	}
+	// Once loaded, stopping does nothing so it has to be navigated away
+	if blocked.RedirectURL == "" && state == "stop" {
+		blocked.RedirectURL = "about:blank"
+	}
+	if blocked.RedirectURL != "" {
+		f.log.Infof("Blocked navigation of %v to %v, redirecting to %v", t.ID, url, blocked.RedirectURL)
+		t.root.send(&actorMessage{To: t.frameID, Type: "navigateTo", URL: blocked.RedirectURL})
+	} else {
+		f.log.Infof("Blocked navigation of %v to %v, stopping", t.ID, url)
+		// Evaluation waits on a reply, so it can't happen under the lock
+		go func() {
+			ctx, cancel := context.WithTimeout(f.runCtx, 10*time.Second)
+			defer cancel()
+			if err := t.Stop(ctx); err != nil {
+				f.log.Errorf("Failed stopping blocked navigation: %v", err)
+			}
+		}()
+	}
+	if policy != nil && policy.OnBlocked != nil {
+		go policy.OnBlocked(blocked)
+	}
+	return true
+}
+
+// Merges the WebsiteFilter policy into the install's policies.json, leaving
+// other policies alone
+func (f *Firefox) writeEnterprisePolicy() error {
+	filter := f.config.NavigationPolicy.websiteFilter()
+	policiesPath := filepath.Join(filepath.Dir(f.config.FirefoxPath), "distribution", "policies.json")
+	var file map[string]interface{}
+	if b, err := ioutil.ReadFile(policiesPath); err == nil {
+		if err := json.Unmarshal(b, &file); err != nil {
+			return fmt.Errorf("invalid %v: %w", policiesPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed reading policies: %w", err)
+	}
+	if file == nil {
+		file = map[string]interface{}{}
+	}
+	policies, _ := file["policies"].(map[string]interface{})
+	if policies == nil {
+		policies = map[string]interface{}{}
+		file["policies"] = policies
+	}
+	policies["WebsiteFilter"] = filter
+	b, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	f.log.Debugf("writing enterprise policy file %v", policiesPath)
+	if err := os.MkdirAll(filepath.Dir(policiesPath), 0755); err != nil {
+		return fmt.Errorf("failed creating distribution dir: %w", err)
+	} else if err := ioutil.WriteFile(policiesPath, b, 0644); err != nil {
+		return fmt.Errorf("failed writing policies: %w", err)
+	}
+	return nil
+}
+
+type websiteFilter struct {
+	Block      []string `json:"Block"`
+	Exceptions []string `json:"Exceptions,omitempty"`
+}
+
+// Exceptions override blocks in the filter, so allow rules become exceptions
+// to blocking everything. If any allow rule can't be expressed, only the deny
+// rules are used so allowed sites aren't blocked.
+func (p *NavigationPolicy) websiteFilter() *websiteFilter {
+	filter := &websiteFilter{Block: []string{}}
+	for _, rule := range p.Deny {
+		if pattern, ok := rule.matchPattern(); ok {
+			filter.Block = append(filter.Block, pattern)
+		}
+	}
+	var exceptions []string
+	for _, rule := range p.Allow {
+		pattern, ok := rule.matchPattern()
+		if !ok {
+			return filter
+		}
+		exceptions = append(exceptions, pattern)
+	}
+	if len(exceptions) > 0 {
+		filter.Block = append(filter.Block, "<all_urls>")
+		filter.Exceptions = exceptions
+	}
+	return filter
+}
+
+// WebExtension match pattern for the rule, false if it can't be expressed
+func (n *NavigationRule) matchPattern() (string, bool) {
+	if n.Regexp != nil {
+		return "", false
+	}
+	scheme := strings.ToLower(n.Scheme)
+	host := strings.ToLower(n.Host)
+	switch scheme {
+	case "":
+		scheme = "*"
+	case "file":
+		if host != "" {
+			return "", false
+		}
+		return "file:///*", true
+	case "http", "https", "ws", "wss", "ftp":
+	default:
+		return "", false
+	}
+	// Only a leading "*." or a lone "*" wildcard is supported
+	if host == "" {
+		host = "*"
+	} else if host != "*" && strings.ContainsAny(strings.TrimPrefix(host, "*."), "*?[") {
+		return "", false
+	}
+	return scheme + "://" + host + "/*", true
+}
@@ -0,0 +1,188 @@
+package firefox
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestNavigationPolicyAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  NavigationPolicy
+		allowed []string
+		blocked []string
+	}{
+		{
+			name:    "no rules",
+			allowed: []string{"https://example.com/", "file:///tmp/a.html"},
+		},
+		{
+			name:    "allow host",
+			policy:  NavigationPolicy{Allow: []NavigationRule{{Host: "*.example.com"}}},
+			allowed: []string{"https://example.com/", "https://www.example.com/a", "http://A.B.Example.COM/", "about:blank"},
+			blocked: []string{"https://example.org/", "https://notexample.com/", "https://example.com.evil/", "::"},
+		},
+		{
+			name: "allow scheme and host",
+			policy: NavigationPolicy{Allow: []NavigationRule{
+				{Scheme: "HTTPS", Host: "example.com"},
+				{Scheme: "file"},
+			}},
+			allowed: []string{"https://example.com/", "file:///tmp/a.html"},
+			blocked: []string{"http://example.com/", "https://www.example.com/"},
+		},
+		{
+			name: "deny overrides allow",
+			policy: NavigationPolicy{
+				Allow: []NavigationRule{{Host: "*.example.com"}},
+				Deny:  []NavigationRule{{Regexp: regexp.MustCompile(`/admin`)}},
+			},
+			allowed: []string{"https://example.com/", "https://www.example.com/user"},
+			blocked: []string{"https://example.com/admin", "https://www.example.com/admin/x"},
+		},
+		{
+			name:    "deny only",
+			policy:  NavigationPolicy{Deny: []NavigationRule{{Host: "ads.*"}, {Scheme: "ftp"}}},
+			allowed: []string{"https://example.com/", "https://www.ads.com/"},
+			blocked: []string{"https://ads.example.com/", "ftp://example.com/"},
+		},
+		{
+			name:    "empty rule matches all",
+			policy:  NavigationPolicy{Deny: []NavigationRule{{}}},
+			allowed: []string{"about:blank"},
+			blocked: []string{"https://example.com/", "about:config"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, u := range test.allowed {
+				if !test.policy.Allowed(u) {
+					t.Errorf("expected %v allowed", u)
+				}
+			}
+			for _, u := range test.blocked {
+				if test.policy.Allowed(u) {
+					t.Errorf("expected %v blocked", u)
+				}
+			}
+		})
+	}
+}
+
+func TestHostGlobMatches(t *testing.T) {
+	tests := []struct {
+		glob    string
+		host    string
+		matches bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "www.example.com", false},
+		{"*.example.com", "example.com", true},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "badexample.com", false},
+		{"*", "example.com", true},
+		{"*", "", true},
+		{"example.*", "example.org", true},
+		{"ex?mple.com", "exemple.com", true},
+		{"[", "example.com", false},
+	}
+	for _, test := range tests {
+		if matches := hostGlobMatches(test.glob, test.host); matches != test.matches {
+			t.Errorf("glob %q on %q: expected %v, got %v", test.glob, test.host, test.matches, matches)
+		}
+	}
+}
+
+func TestNavigationRuleMatchPattern(t *testing.T) {
+	tests := []struct {
+		rule    NavigationRule
+		pattern string
+	}{
+		{NavigationRule{}, "*://*/*"},
+		{NavigationRule{Host: "Example.com"}, "*://example.com/*"},
+		{NavigationRule{Scheme: "HTTPS", Host: "*.example.com"}, "https://*.example.com/*"},
+		{NavigationRule{Scheme: "wss", Host: "*"}, "wss://*/*"},
+		{NavigationRule{Scheme: "file"}, "file:///*"},
+		// Can't be expressed
+		{NavigationRule{Scheme: "file", Host: "example.com"}, ""},
+		{NavigationRule{Scheme: "about"}, ""},
+		{NavigationRule{Host: "example.*"}, ""},
+		{NavigationRule{Host: "*.ex?mple.com"}, ""},
+		{NavigationRule{Regexp: regexp.MustCompile(`.*`)}, ""},
+	}
+	for _, test := range tests {
+		pattern, ok := test.rule.matchPattern()
+		if ok != (test.pattern != "") || pattern != test.pattern {
+			t.Errorf("rule %+v: expected %q, got %q (%v)", test.rule, test.pattern, pattern, ok)
+		}
+	}
+}
+
+func TestNavigationPolicyWebsiteFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy NavigationPolicy
+		filter websiteFilter
+	}{
+		{
+			name:   "no rules",
+			filter: websiteFilter{Block: []string{}},
+		},
+		{
+			name: "allow and deny",
+			policy: NavigationPolicy{
+				Allow: []NavigationRule{{Host: "*.example.com"}, {Scheme: "https", Host: "go.dev"}},
+				Deny:  []NavigationRule{{Host: "ads.example.com"}},
+			},
+			filter: websiteFilter{
+				Block:      []string{"*://ads.example.com/*", "<all_urls>"},
+				Exceptions: []string{"*://*.example.com/*", "https://go.dev/*"},
+			},
+		},
+		{
+			name: "deny not expressed",
+			policy: NavigationPolicy{
+				Deny: []NavigationRule{{Regexp: regexp.MustCompile(`/admin`)}, {Host: "ads.example.com"}},
+			},
+			filter: websiteFilter{Block: []string{"*://ads.example.com/*"}},
+		},
+		{
+			// Blocking everything else would block the allowed site
+			name: "allow not expressed",
+			policy: NavigationPolicy{
+				Allow: []NavigationRule{{Host: "*.example.com"}, {Regexp: regexp.MustCompile(`^https://go\.dev/`)}},
+				Deny:  []NavigationRule{{Host: "ads.example.com"}},
+			},
+			filter: websiteFilter{Block: []string{"*://ads.example.com/*"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if filter := test.policy.websiteFilter(); !reflect.DeepEqual(*filter, test.filter) {
+				t.Fatalf("expected %+v, got %+v", test.filter, *filter)
+			}
+		})
+	}
+}
+
+func TestStartRedirectNotAllowed(t *testing.T) {
+	for _, config := range []Config{
+		{NavigationPolicy: &NavigationPolicy{
+			Allow:       []NavigationRule{{Host: "example.com"}},
+			RedirectURL: "https://example.org/",
+		}},
+		{Kiosk: true, NavigationPolicy: &NavigationPolicy{RedirectURL: "about:config"}},
+	} {
+		config.FirefoxPath = "firefox"
+		config.ProfilePath = t.TempDir()
+		_, err := Start(context.Background(), config)
+		var startupErr *StartupError
+		if !errors.As(err, &startupErr) || startupErr.Stage != StartupStageProfilePrepared {
+			t.Fatalf("expected startup error, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package firefox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Config derived content is written between a section's lines in a profile
+// file, replacing the previous content each start. The rest of the file is
+// left alone.
+type configSection struct {
+	begin string
+	end   string
+}
+
+var (
+	userJSSection = configSection{
+		begin: "// Begin prefs from config, rewritten each start",
+		end:   "// End prefs from config",
+	}
+	userChromeCSSSection = configSection{
+		begin: "/* Begin rules from config, rewritten each start */",
+		end:   "/* End rules from config */",
+	}
+)
+
+type userPref struct {
+	name string
+	// JSON encoded in user.js
+	value interface{}
+}
+
+func (f *Firefox) configPrefs() []userPref {
+	var prefs []userPref
+	if f.config.DownloadDir != "" {
+		prefs = append(prefs, []userPref{
+			{"browser.download.folderList", 2},
+			{"browser.download.dir", f.config.DownloadDir},
+			{"browser.download.useDownloadDir", true},
+			{"browser.download.always_ask_before_handling_new_types", false},
+			// Older Firefox only skips the prompt for listed types
+			{"browser.helperApps.neverAsk.saveToDisk", downloadMimeTypes},
+			// Don't pop open the downloads panel
+			{"browser.download.panel.shown", true},
+			{"browser.download.alwaysOpenPanel", false},
+		}...)
+	}
+	if f.config.Containers {
+		prefs = append(prefs, userPref{"privacy.userContext.enabled", true})
+	}
+	if f.config.Kiosk {
+		prefs = append(prefs, kioskPrefs...)
+	}
+	return prefs
+}
+
+const downloadMimeTypes = "application/octet-stream,application/x-msdownload,application/zip," +
+	"application/x-zip-compressed,application/gzip,application/x-gzip,application/x-tar," +
+	"application/x-7z-compressed,application/x-rar-compressed,application/pdf," +
+	"application/msword,application/vnd.ms-excel,application/vnd.ms-powerpoint," +
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document," +
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet," +
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation," +
+	"application/json,application/xml,text/csv,text/plain,image/png,image/jpeg," +
+	"image/gif,audio/mpeg,video/mp4,binary/octet-stream"
+
+// What --kiosk would do that matters when embedded, plus avoiding anything
+// that would prompt or open more windows
+var kioskPrefs = []userPref{
+	// New windows and tabs open in the current tab
+	{"browser.link.open_newwindow", 1},
+	{"browser.link.open_newwindow.restriction", 0},
+	{"browser.tabs.closeWindowWithLastTab", false},
+	{"browser.sessionstore.resume_from_crash", false},
+	{"browser.startup.homepage_override.mstone", "ignore"},
+	{"startup.homepage_welcome_url", ""},
+	{"browser.aboutwelcome.enabled", false},
+	{"browser.uitour.enabled", false},
+	{"datareporting.policy.dataSubmissionEnabled", false},
+	{"full-screen-api.enabled", false},
+	{"ui.key.menuAccessKeyFocuses", false},
+	{"xpinstall.enabled", false},
+	{"signon.rememberSignons", false},
+	{"browser.formfill.enable", false},
+	// Deny instead of asking
+	{"permissions.default.desktop-notification", 2},
+	{"permissions.default.geo", 2},
+	{"permissions.default.camera", 2},
+	{"permissions.default.microphone", 2},
+}
+
+func (f *Firefox) configPrefsJS() string {
+	var js strings.Builder
+	for _, pref := range f.configPrefs() {
+		// Only basic values, so marshaling can't fail
+		value, _ := json.Marshal(pref.value)
+		fmt.Fprintf(&js, "user_pref(%q, %s);\n", pref.name, value)
+	}
+	return js.String()
+}
+
+// Hides context menus, popups, and notification bars. Select dropdowns are
+// left alone since pages need them.
+const kioskUserChromeCSS = `#contentAreaContextMenu, #tabContextMenu, #toolbar-context-menu,
+#sidebar-box, #sidebar-splitter, #PopupAutoComplete, #notification-popup,
+#identity-popup, #permission-popup, #appMenu-popup, #downloadsPanel,
+#pageActionPanel, #customizationui-widget-panel, #fullscreen-warning,
+#global-notificationbox, #tab-notification-deck {display: none !important;}
+`
+
+func (f *Firefox) configUserChromeCSS() string {
+	if f.config.Kiosk {
+		return kioskUserChromeCSS
+	}
+	return ""
+}
+
+// Replaces the section's content in the file, removing the section if content
+// is empty. Only writes if changed.
+func (f *Firefox) writeConfigSection(path string, section configSection, content string) error {
+	name := filepath.Base(path)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed reading %v: %w", name, err)
+	}
+	existing := string(b)
+	updated := existing
+	if begin := strings.Index(updated, section.begin); begin >= 0 {
+		end := strings.Index(updated[begin:], section.end)
+		if end < 0 {
+			return fmt.Errorf("%v has %q without %q", name, section.begin, section.end)
+		}
+		end += begin + len(section.end)
+		updated = strings.TrimRight(updated[:begin], "\n") + "\n" + strings.TrimLeft(updated[end:], "\n")
+	}
+	if content != "" {
+		updated = strings.TrimRight(updated, "\n") + "\n\n" + section.begin + "\n" + content + section.end + "\n"
+	}
+	if updated == existing {
+		return nil
+	}
+	f.log.Debugf("writing config section to %v", path)
+	if err := ioutil.WriteFile(path, []byte(updated), 0644); err != nil {
+		return fmt.Errorf("failed writing %v: %w", name, err)
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package firefox
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,11 +12,16 @@ import (
 	"sync"
 )
 
+// Send and receive buffers larger than this are not kept after use
+const maxKeptBufSize = 64 * 1024
+
 type remote struct {
 	firefox *Firefox
 	rw      io.ReadWriteCloser
 
 	bufWrite *bufio.Writer
+	sendBuf  bytes.Buffer
+	sendEnc  *json.Encoder
 	sendLock sync.Mutex
 
 	bufRead  *bufio.Reader
@@ -22,40 +29,54 @@ type remote struct {
 	recvLock sync.Mutex
 }
 
-func (f *Firefox) dialRemote(addr string) (*remote, error) {
-	conn, err := net.Dial("tcp", addr)
+// The context only bounds connecting
+func (f *Firefox) dialRemote(ctx context.Context, addr string) (*remote, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return nil, err
 	}
-	return &remote{
+	return f.newRemote(conn), nil
+}
+
+func (f *Firefox) newRemote(rw io.ReadWriteCloser) *remote {
+	r := &remote{
 		firefox:  f,
-		rw:       conn,
-		bufWrite: bufio.NewWriter(conn),
-		bufRead:  bufio.NewReader(conn),
+		rw:       rw,
+		bufWrite: bufio.NewWriter(rw),
+		bufRead:  bufio.NewReader(rw),
 		recvBuf:  make([]byte, 500),
-	}, nil
+	}
+	r.sendEnc = json.NewEncoder(&r.sendBuf)
+	r.sendEnc.SetEscapeHTML(false)
+	return r
 }
 
-// Should not be called concurrently
+// Safe for concurrent use
 func (r *remote) send(jsonVal interface{}) error {
 	r.sendLock.Lock()
 	defer r.sendLock.Unlock()
-	// Write len, colon, then json
-	// TODO: Use buffer w/ encoder for better perf
-	b, err := json.Marshal(jsonVal)
-	if err != nil {
+	// Encode into the reused buffer, dropping the encoder's newline
+	r.sendBuf.Reset()
+	if err := r.sendEnc.Encode(jsonVal); err != nil {
 		return fmt.Errorf("failed marshaling json: %w", err)
 	}
+	b := bytes.TrimSuffix(r.sendBuf.Bytes(), []byte{'\n'})
 	if r.firefox.config.LogRemoteMessages {
 		r.firefox.log.Debugf("Sending message: %s", b)
 	}
-	if _, err = r.bufWrite.WriteString(strconv.Itoa(len(b))); err != nil {
+	// Write len, colon, then json
+	var lenBuf [20]byte
+	if _, err := r.bufWrite.Write(strconv.AppendInt(lenBuf[:0], int64(len(b)), 10)); err != nil {
 		return err
 	} else if err = r.bufWrite.WriteByte(':'); err != nil {
 		return err
 	} else if _, err = r.bufWrite.Write(b); err != nil {
 		return err
 	}
+	// Don't let a huge message pin memory
+	if r.sendBuf.Cap() > maxKeptBufSize {
+		r.sendBuf = bytes.Buffer{}
+	}
 	return r.bufWrite.Flush()
 }
 
@@ -63,27 +84,31 @@ func (r *remote) send(jsonVal interface{}) error {
 func (r *remote) recv(jsonVal interface{}) error {
 	r.recvLock.Lock()
 	defer r.recvLock.Unlock()
-	// Read until colon to get msg size
-	var size int
-	if sizeStr, err := r.bufRead.ReadString(':'); err != nil {
+	// Read the header to get msg size
+	size, err := ReadPacketHeader(r.bufRead, r.firefox.config.MaxPacketSize)
+	if err != nil {
 		return err
-	} else if size, err = strconv.Atoi(string(sizeStr[:len(sizeStr)-1])); err != nil {
-		return fmt.Errorf("invalid size string %s: %w", sizeStr[:len(sizeStr)-1], err)
 	}
-	// Make sure the read buf is big enough
-	if len(r.recvBuf) < size {
+	// Read into a reused buffer instead of decoding from the stream, since a
+	// json.Decoder reads the whole value into its own new buffer anyway. Make
+	// sure it is big enough, but don't keep it if too large.
+	if cap(r.recvBuf) < size {
 		r.recvBuf = make([]byte, size)
 	}
+	buf := r.recvBuf[:size]
+	if cap(r.recvBuf) > maxKeptBufSize {
+		r.recvBuf = make([]byte, 500)
+	}
 	// Read the rest
-	if _, err := io.ReadFull(r.bufRead, r.recvBuf[:size]); err != nil {
+	if _, err := io.ReadFull(r.bufRead, buf); err != nil {
 		return err
 	}
 	if r.firefox.config.LogRemoteMessages {
-		r.firefox.log.Debugf("Received message: %s", r.recvBuf[:size])
+		r.firefox.log.Debugf("Received message: %s", buf)
 	}
-	// Unmarshal
-	if err := json.Unmarshal(r.recvBuf[:size], jsonVal); err != nil {
-		return fmt.Errorf("failed unmarshaling json: %w - original string: %s", err, r.recvBuf[:size])
+	// Unmarshal, values must not retain the buffer
+	if err := json.Unmarshal(buf, jsonVal); err != nil {
+		return fmt.Errorf("failed unmarshaling json: %w", err)
 	}
 	return nil
 }
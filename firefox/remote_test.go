@@ -0,0 +1,112 @@
+package firefox
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRemoteSendRecv(t *testing.T) {
+	f, conn := newTestRemote(t)
+	// Client to server
+	go f.remote.send(&actorMessage{To: "tab1", Type: "navigateTo", URL: "https://example.com/?a=<b>&c"})
+	connRead := bufio.NewReader(conn)
+	size, err := ReadPacketHeader(connRead, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(connRead, body); err != nil {
+		t.Fatal(err)
+	}
+	// No HTML escaping or trailing newline
+	const expected = `{"to":"tab1","type":"navigateTo","url":"https://example.com/?a=<b>&c"}`
+	if string(body) != expected {
+		t.Fatalf("expected %s, got %s", expected, body)
+	}
+	// Server to client, large enough to replace the buffer then small after
+	large := strings.Repeat("x", maxKeptBufSize+1)
+	go conn.Write(framePackets(t,
+		map[string]interface{}{"from": "tab1", "type": "tabNavigated", "url": large},
+		map[string]interface{}{"from": "tab1", "type": "tabNavigated", "url": "about:blank"},
+	))
+	var msg actorMessage
+	if err := f.remote.recv(&msg); err != nil {
+		t.Fatal(err)
+	} else if msg.URL != large {
+		t.Fatalf("unexpected large message of length %v", len(msg.URL))
+	} else if cap(f.remote.recvBuf) > maxKeptBufSize {
+		t.Fatalf("large receive buffer of %v kept", cap(f.remote.recvBuf))
+	}
+	firstRaw := string(msg.raw)
+	msg = actorMessage{}
+	if err := f.remote.recv(&msg); err != nil {
+		t.Fatal(err)
+	} else if msg.URL != "about:blank" || msg.Type != "tabNavigated" || msg.From != "tab1" {
+		t.Fatalf("unexpected message %s", msg.raw)
+	}
+	// Raw must not share the reused buffer
+	if firstRaw != `{"from":"tab1","type":"tabNavigated","url":"`+large+`"}` {
+		t.Fatalf("raw message changed after next receive")
+	}
+}
+
+func BenchmarkSend(b *testing.B) {
+	f, conn := newTestRemote(b)
+	go io.Copy(ioutil.Discard, conn)
+	msg := &actorMessage{To: "server1.conn0.child2/frameTarget1", Type: "navigateTo", URL: "https://example.com/"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := f.remote.send(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRecv(b *testing.B) {
+	benchmarkRecv := func(b *testing.B, packet map[string]interface{}) {
+		f, conn := newTestRemote(b)
+		framed := framePackets(b, packet)
+		go func() {
+			for i := 0; i < b.N; i++ {
+				if _, err := conn.Write(framed); err != nil {
+					return
+				}
+			}
+		}()
+		b.ReportAllocs()
+		b.SetBytes(int64(len(framed)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var msg actorMessage
+			if err := f.remote.recv(&msg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.Run("event", func(b *testing.B) {
+		benchmarkRecv(b, map[string]interface{}{
+			"from":  "server1.conn0.child2/frameTarget1",
+			"type":  "tabNavigated",
+			"state": "stop",
+			"url":   "https://example.com/",
+			"title": "Example Domain",
+		})
+	})
+	b.Run("large", func(b *testing.B) {
+		benchmarkRecv(b, map[string]interface{}{
+			"from":  "server1.conn0.child2/consoleActor3",
+			"value": strings.Repeat("x", 32*1024),
+		})
+	})
+	// Past maxKeptBufSize so the buffer isn't reused
+	b.Run("huge", func(b *testing.B) {
+		benchmarkRecv(b, map[string]interface{}{
+			"from":  "server1.conn0.child2/consoleActor3",
+			"value": strings.Repeat("x", 256*1024),
+		})
+	})
+}
@@ -0,0 +1,52 @@
+package firefox
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type ScreenshotOptions struct {
+	// Default is just the visible viewport
+	FullPage bool
+	// CSS selector of a single element to capture. Default is no element.
+	Selector string
+	// Default is the window's device pixel ratio
+	DevicePixelRatio float64
+}
+
+// Screenshot captures PNG data of the current target using its screenshot
+// actor. This does not need a visible window so it works headless.
+func (t *TabActor) Screenshot(ctx context.Context, opts ScreenshotOptions) ([]byte, error) {
+	t.fieldsLock.RLock()
+	screenshotActor := t.screenshotActor
+	t.fieldsLock.RUnlock()
+	if screenshotActor == "" {
+		return nil, fmt.Errorf("no screenshot actor for tab")
+	}
+	args := map[string]interface{}{"fullpage": opts.FullPage}
+	if opts.Selector != "" {
+		args["selector"] = opts.Selector
+	}
+	if opts.DevicePixelRatio > 0 {
+		args["dpr"] = opts.DevicePixelRatio
+	}
+	reply, err := t.root.mgr.request(ctx, &actorMessage{To: screenshotActor, Type: "capture", Args: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed capturing screenshot: %w", err)
+	}
+	var value struct {
+		Data string `json:"data"`
+	}
+	if err := json.Unmarshal(reply.Value, &value); err != nil {
+		return nil, fmt.Errorf("invalid screenshot result: %w", err)
+	}
+	// Data URL is always PNG base64
+	const prefix = "data:image/png;base64,"
+	if !strings.HasPrefix(value.Data, prefix) {
+		return nil, fmt.Errorf("screenshot has no image, selector may not match")
+	}
+	return base64.StdEncoding.DecodeString(value.Data[len(prefix):])
+}
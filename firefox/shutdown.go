@@ -0,0 +1,86 @@
+package firefox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ShutdownMethod is how Shutdown ended Firefox
+type ShutdownMethod int
+
+const (
+	// Firefox quit when asked via chrome evaluation
+	ShutdownQuit ShutdownMethod = iota
+	// Chrome evaluation failed, but Firefox quit when its window was closed
+	ShutdownWindowClose
+	// Firefox didn't exit in time or couldn't be asked, so it was killed
+	ShutdownKill
+)
+
+func (s ShutdownMethod) String() string {
+	switch s {
+	case ShutdownQuit:
+		return "quit"
+	case ShutdownWindowClose:
+		return "window close"
+	case ShutdownKill:
+		return "kill"
+	default:
+		return fmt.Sprintf("ShutdownMethod(%d)", int(s))
+	}
+}
+
+// Longest to wait for the quit request, leaving the rest of the context for
+// exiting
+const shutdownRequestTimeout = 5 * time.Second
+
+// Quits on the next tick so the evaluation result gets back first
+const shutdownQuitJS = `Services.tm.dispatchToMainThread(() => Services.startup.quit(Ci.nsIAppStartup.eAttemptQuit))`
+
+// Shutdown asks Firefox to quit so it can write its session and databases,
+// waits until the context is done for it to exit, and kills it like Close if
+// it doesn't. The returned method is how it ended. Firefox is unusable after
+// this and Close does not need to be called, though it may be.
+func (f *Firefox) Shutdown(ctx context.Context) (ShutdownMethod, error) {
+	if f.pid == 0 {
+		return ShutdownKill, f.Close()
+	}
+	proc, err := os.FindProcess(int(f.pid))
+	if err != nil {
+		f.log.Errorf("Failed finding Firefox process, killing: %v", err)
+		return ShutdownKill, f.Close()
+	}
+	exitCh := make(chan struct{})
+	go func() {
+		proc.Wait()
+		close(exitCh)
+	}()
+	method := ShutdownQuit
+	requestCtx, cancel := context.WithTimeout(ctx, shutdownRequestTimeout)
+	_, err = f.EvaluateChrome(requestCtx, shutdownQuitJS)
+	cancel()
+	if err != nil {
+		f.log.Infof("Failed asking Firefox to quit, closing its window instead: %v", err)
+		method = ShutdownWindowClose
+		if err := f.closeNativeWindow(); err != nil {
+			f.log.Errorf("Failed closing Firefox window, killing: %v", err)
+			return ShutdownKill, f.Close()
+		}
+	}
+	// The connection closing as Firefox exits is expected now
+	f.runCancel()
+	select {
+	case <-exitCh:
+		f.log.Debugf("Firefox exited after %v", method)
+		f.closeConnection()
+		f.release()
+		// Don't let a later Close kill a reused PID
+		f.pid = 0
+		return method, nil
+	case <-ctx.Done():
+		f.log.Infof("Firefox did not exit in time, killing")
+		return ShutdownKill, f.Close()
+	}
+}
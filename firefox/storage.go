@@ -0,0 +1,233 @@
+package firefox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type StorageType string
+
+const (
+	StorageCookies StorageType = "cookies"
+	StorageLocal   StorageType = "localStorage"
+	StorageSession StorageType = "sessionStorage"
+	// Items are databases, they can only be listed and removed
+	StorageIndexedDB StorageType = "indexedDB"
+)
+
+type StorageItem struct {
+	Name  string
+	Value string
+
+	// Cookies only
+	Host     string
+	Path     string
+	Expires  time.Time
+	HTTPOnly bool
+	Secure   bool
+	SameSite string
+
+	// Needed for editing
+	raw map[string]interface{}
+}
+
+type actorStore struct {
+	Actor string `json:"actor"`
+	// Values are paths which we don't use
+	Hosts map[string]json.RawMessage `json:"hosts"`
+}
+
+type actorStorageItem struct {
+	Name       string          `json:"name"`
+	Value      json.RawMessage `json:"value"`
+	Host       string          `json:"host"`
+	Path       string          `json:"path"`
+	Expires    float64         `json:"expires"`
+	IsHTTPOnly bool            `json:"isHttpOnly"`
+	IsSecure   bool            `json:"isSecure"`
+	SameSite   string          `json:"sameSite"`
+}
+
+// StorageHosts lists the hosts that have storage of the given type
+func (t *TabActor) StorageHosts(ctx context.Context, typ StorageType) ([]string, error) {
+	store, err := t.getStore(ctx, typ)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, 0, len(store.Hosts))
+	for host := range store.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// StorageItems lists all items for the host
+func (t *TabActor) StorageItems(ctx context.Context, typ StorageType, host string) ([]*StorageItem, error) {
+	store, err := t.getStore(ctx, typ)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := t.root.mgr.request(ctx, &actorMessage{To: store.Actor, Type: "getStoreObjects", Host: host})
+	if err != nil {
+		return nil, fmt.Errorf("failed getting %v items: %w", typ, err)
+	}
+	var raws []json.RawMessage
+	if len(reply.Data) > 0 {
+		if err := json.Unmarshal(reply.Data, &raws); err != nil {
+			return nil, fmt.Errorf("invalid %v items: %w", typ, err)
+		}
+	}
+	items := make([]*StorageItem, len(raws))
+	for i, raw := range raws {
+		var item actorStorageItem
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, fmt.Errorf("invalid %v item: %w", typ, err)
+		}
+		items[i] = &StorageItem{
+			Name:     item.Name,
+			Host:     item.Host,
+			Path:     item.Path,
+			HTTPOnly: item.IsHTTPOnly,
+			Secure:   item.IsSecure,
+			SameSite: item.SameSite,
+		}
+		if item.Expires > 0 {
+			items[i].Expires = msTime(item.Expires)
+		}
+		if len(item.Value) > 0 {
+			if items[i].Value, err = t.root.mgr.resolveString(ctx, item.Value); err != nil {
+				return nil, err
+			}
+		}
+		json.Unmarshal(raw, &items[i].raw)
+	}
+	return items, nil
+}
+
+// StorageItem returns the named item for the host or nil if not present. For
+// cookies, the first cookie with the name is returned regardless of path.
+func (t *TabActor) StorageItem(ctx context.Context, typ StorageType, host, name string) (*StorageItem, error) {
+	items, err := t.StorageItems(ctx, typ, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.Name == name {
+			return item, nil
+		}
+	}
+	return nil, nil
+}
+
+// SetStorageItem sets the value of the named item, creating it if not present.
+// Not supported for IndexedDB.
+func (t *TabActor) SetStorageItem(ctx context.Context, typ StorageType, host, name, value string) error {
+	if typ == StorageIndexedDB {
+		return fmt.Errorf("cannot set IndexedDB items")
+	}
+	store, err := t.getStore(ctx, typ)
+	if err != nil {
+		return err
+	}
+	// Firefox can only add items with default values named by the guid, so add
+	// then edit
+	item, err := t.StorageItem(ctx, typ, host, name)
+	if err != nil {
+		return err
+	} else if item == nil {
+		_, err := t.root.mgr.request(ctx, &actorMessage{To: store.Actor, Type: "addItem", GUID: name, Host: host})
+		if err != nil {
+			return fmt.Errorf("failed adding %v item: %w", typ, err)
+		} else if item, err = t.StorageItem(ctx, typ, host, name); err != nil {
+			return err
+		} else if item == nil {
+			return fmt.Errorf("%v item not present after add", typ)
+		}
+	}
+	items := map[string]interface{}{}
+	for k, v := range item.raw {
+		items[k] = v
+	}
+	items["value"] = value
+	data, err := json.Marshal(map[string]interface{}{
+		"host":     host,
+		"field":    "value",
+		"oldValue": item.Value,
+		"newValue": value,
+		"items":    items,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := t.root.mgr.request(ctx, &actorMessage{To: store.Actor, Type: "editItem", Data: data}); err != nil {
+		return fmt.Errorf("failed editing %v item: %w", typ, err)
+	}
+	return nil
+}
+
+// RemoveStorageItem removes the named item. For IndexedDB, this deletes the
+// database.
+func (t *TabActor) RemoveStorageItem(ctx context.Context, typ StorageType, host, name string) error {
+	store, err := t.getStore(ctx, typ)
+	if err != nil {
+		return err
+	}
+	msgType := "removeItem"
+	if typ == StorageIndexedDB {
+		msgType = "removeDatabase"
+	}
+	if _, err := t.root.mgr.request(ctx, &actorMessage{To: store.Actor, Type: msgType, Host: host, Name: name}); err != nil {
+		return fmt.Errorf("failed removing %v item: %w", typ, err)
+	}
+	return nil
+}
+
+// ClearStorage removes all items for the host. Not supported for IndexedDB,
+// use RemoveStorageItem for each database instead.
+func (t *TabActor) ClearStorage(ctx context.Context, typ StorageType, host string) error {
+	if typ == StorageIndexedDB {
+		return fmt.Errorf("cannot clear IndexedDB")
+	}
+	store, err := t.getStore(ctx, typ)
+	if err != nil {
+		return err
+	}
+	if _, err := t.root.mgr.request(ctx, &actorMessage{To: store.Actor, Type: "removeAll", Host: host}); err != nil {
+		return fmt.Errorf("failed clearing %v: %w", typ, err)
+	}
+	return nil
+}
+
+func (t *TabActor) getStore(ctx context.Context, typ StorageType) (*actorStore, error) {
+	t.fieldsLock.RLock()
+	storageActor := t.storageActor
+	t.fieldsLock.RUnlock()
+	if storageActor == "" {
+		return nil, fmt.Errorf("no storage actor for tab")
+	}
+	reply, err := t.root.mgr.request(ctx, &actorMessage{To: storageActor, Type: "listStores"})
+	if err != nil {
+		return nil, fmt.Errorf("failed listing stores: %w", err)
+	}
+	var store *actorStore
+	switch typ {
+	case StorageCookies:
+		store = reply.Cookies
+	case StorageLocal:
+		store = reply.LocalStorage
+	case StorageSession:
+		store = reply.SessionStorage
+	case StorageIndexedDB:
+		store = reply.IndexedDB
+	default:
+		return nil, fmt.Errorf("unknown storage type %v", typ)
+	}
+	if store == nil {
+		return nil, fmt.Errorf("storage type %v not available", typ)
+	}
+	return store, nil
+}
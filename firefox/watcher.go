@@ -0,0 +1,160 @@
+package firefox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Watcher for a tab descriptor. Resource handlers are called in order on the
+// watcher's dispatch goroutine so they should not block.
+type watcherActor struct {
+	id  string
+	tab *TabActor
+
+	// Keyed by resource type
+	handlers     map[string]func(res *actorResource, updated bool)
+	handlersLock sync.RWMutex
+}
+
+type actorResource struct {
+	ResourceType string          `json:"resourceType,omitempty"`
+	ResourceID   json.RawMessage `json:"resourceId,omitempty"`
+	Actor        string          `json:"actor,omitempty"`
+	// Only on updates
+	ResourceUpdates json.RawMessage `json:"resourceUpdates,omitempty"`
+
+	// Entire resource
+	raw json.RawMessage
+}
+
+// Unique per resource type
+func (a *actorResource) id() string {
+	if len(a.ResourceID) > 0 {
+		return string(a.ResourceID)
+	}
+	return a.Actor
+}
+
+// Gets (creating if necessary) the watcher for the tab
+func (t *TabActor) getWatcher(ctx context.Context) (*watcherActor, error) {
+	t.watcherLock.Lock()
+	defer t.watcherLock.Unlock()
+	if t.watcher != nil {
+		return t.watcher, nil
+	}
+	reply, err := t.root.mgr.request(ctx, &actorMessage{To: t.ID, Type: "getWatcher"})
+	if err != nil {
+		return nil, fmt.Errorf("failed getting watcher: %w", err)
+	} else if reply.Actor == "" {
+		return nil, fmt.Errorf("watcher not supported")
+	}
+	w := &watcherActor{id: reply.Actor, tab: t, handlers: map[string]func(*actorResource, bool){}}
+	t.root.mgr.setActor(w.id, w)
+	go func() {
+		<-t.ctx.Done()
+		t.root.mgr.removeActor(w.id)
+	}()
+	t.watcher = w
+	return w, nil
+}
+
+// Sets the handler for the resource type and starts watching it if not
+// already
+func (w *watcherActor) watchResource(
+	ctx context.Context,
+	resourceType string,
+	handler func(res *actorResource, updated bool),
+) error {
+	w.handlersLock.Lock()
+	_, alreadyWatching := w.handlers[resourceType]
+	w.handlers[resourceType] = handler
+	w.handlersLock.Unlock()
+	if alreadyWatching {
+		return nil
+	}
+	_, err := w.tab.root.mgr.request(ctx, &actorMessage{
+		To:            w.id,
+		Type:          "watchResources",
+		ResourceTypes: []string{resourceType},
+	})
+	if err != nil {
+		w.handlersLock.Lock()
+		delete(w.handlers, resourceType)
+		w.handlersLock.Unlock()
+		return fmt.Errorf("failed watching %v: %w", resourceType, err)
+	}
+	return nil
+}
+
+func (w *watcherActor) onMessage(msg *actorMessage) {
+	var resources []*actorResource
+	var updated bool
+	var err error
+	switch msg.Type {
+	case "resource-available-form":
+		resources, err = decodeResources("", msg.Resources)
+	case "resource-updated-form":
+		resources, err = decodeResources("", msg.Resources)
+		updated = true
+	case "resources-available-array":
+		resources, err = decodeResourceArray(msg.Array)
+	case "resources-updated-array":
+		resources, err = decodeResourceArray(msg.Array)
+		updated = true
+	default:
+		return
+	}
+	if err != nil {
+		w.tab.root.mgr.firefox.log.Errorf("Invalid resources from %v: %v", w.id, err)
+		return
+	}
+	w.handlersLock.RLock()
+	defer w.handlersLock.RUnlock()
+	for _, res := range resources {
+		if handler := w.handlers[res.ResourceType]; handler != nil {
+			handler(res, updated)
+		}
+	}
+}
+
+func decodeResources(resourceType string, raws []json.RawMessage) ([]*actorResource, error) {
+	resources := make([]*actorResource, len(raws))
+	for i, raw := range raws {
+		resources[i] = &actorResource{raw: raw}
+		if err := json.Unmarshal(raw, resources[i]); err != nil {
+			return nil, err
+		} else if resources[i].ResourceType == "" {
+			resources[i].ResourceType = resourceType
+		}
+	}
+	return resources, nil
+}
+
+// Array is of [resourceType, resources] pairs
+func decodeResourceArray(array json.RawMessage) ([]*actorResource, error) {
+	var pairs [][]json.RawMessage
+	if err := json.Unmarshal(array, &pairs); err != nil {
+		return nil, err
+	}
+	var resources []*actorResource
+	for _, pair := range pairs {
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("expected resource pair, got %v items", len(pair))
+		}
+		var resourceType string
+		var raws []json.RawMessage
+		if err := json.Unmarshal(pair[0], &resourceType); err != nil {
+			return nil, err
+		} else if err = json.Unmarshal(pair[1], &raws); err != nil {
+			return nil, err
+		}
+		pairResources, err := decodeResources(resourceType, raws)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, pairResources...)
+	}
+	return resources, nil
+}
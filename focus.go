@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// Moves keyboard focus between the address bar and the embedded page. Methods
+// must be called on the main thread.
+type focusManager struct {
+	*browser
+	window *widgets.QMainWindow
+}
+
+func newFocusManager(b *browser, window *widgets.QMainWindow) *focusManager {
+	f := &focusManager{browser: b, window: window}
+	// Shortcuts while Qt has focus
+	for _, key := range []string{"Ctrl+L", "F6"} {
+		shortcut := widgets.NewQShortcut2(gui.NewQKeySequence2(key, gui.QKeySequence__PortableText),
+			window, "", "", core.Qt__WindowShortcut)
+		shortcut.ConnectActivated(f.focusAddressBar)
+	}
+	// Firefox gets the keys while the page has focus, so it tells us
+	b.firefox.AddressBarShortcutListener.AddFunc(context.Background(), funcOnMain(f.focusAddressBar))
+	return f
+}
+
+// Esc in the address bar returns to the page
+func (f *focusManager) addURLEdit(edit *widgets.QLineEdit) {
+	shortcut := widgets.NewQShortcut2(gui.NewQKeySequence2("Esc", gui.QKeySequence__PortableText),
+		edit, "", "", core.Qt__WidgetShortcut)
+	shortcut.ConnectActivated(f.focusPage)
+}
+
+func (f *focusManager) focusAddressBar() {
+	f.tabsLock.RLock()
+	defer f.tabsLock.RUnlock()
+	if index := f.tabWidget.CurrentIndex(); index >= 0 && index < len(f.tabs) {
+		f.window.ActivateWindow()
+		edit := f.tabs[index].urlEditWidget
+		edit.SetFocus(core.Qt__ShortcutFocusReason)
+		edit.SelectAll()
+	}
+}
+
+func (f *focusManager) focusPage() {
+	f.tabsLock.RLock()
+	defer f.tabsLock.RUnlock()
+	if index := f.tabWidget.CurrentIndex(); index >= 0 && index < len(f.tabs) {
+		// Set the native focus first then tell Firefox which tab has it
+		if err := f.firefox.FocusPage(); err != nil {
+			f.log.Errorf("Failed focusing page: %v", err)
+		}
+		f.tabs[index].tab.SetFocus()
+	}
+}
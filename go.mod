@@ -4,6 +4,7 @@ go 1.15
 
 require (
 	github.com/therecipe/qt v0.0.0-20200904063919-c0c124a5770d
+	go.etcd.io/bbolt v1.3.5
 	go.uber.org/multierr v1.6.0 // indirect
 	go.uber.org/zap v1.16.0
 	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68
@@ -0,0 +1,413 @@
+// Package history records and queries the pages visited in Firefox tabs
+package history
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cretz/ffembedpoc/firefox"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Visit is a single page load
+type Visit struct {
+	URL   string
+	Title string
+	Time  time.Time
+	// Hash of the favicon in the store, empty if unknown
+	FaviconHash string
+	Transition  firefox.Transition
+}
+
+// Entry is every visit to a URL
+type Entry struct {
+	URL string
+	// Latest title seen
+	Title       string
+	FaviconHash string
+	VisitCount  int
+	LastVisit   time.Time
+	// Oldest first, only the most recent few are kept
+	RecentVisits []time.Time
+}
+
+// Number of visits kept on an entry for frecency
+const maxRecentVisits = 10
+
+// Frecency scores the entry by how often and how recently it was visited,
+// weighing each recent visit by its age then scaling to the total count
+func (e *Entry) Frecency(now time.Time) float64 {
+	if len(e.RecentVisits) == 0 {
+		return 0
+	}
+	var total float64
+	for _, t := range e.RecentVisits {
+		switch age := now.Sub(t); {
+		case age < 4*24*time.Hour:
+			total += 100
+		case age < 14*24*time.Hour:
+			total += 70
+		case age < 31*24*time.Hour:
+			total += 50
+		case age < 90*24*time.Hour:
+			total += 30
+		default:
+			total += 10
+		}
+	}
+	return float64(e.VisitCount) * total / float64(len(e.RecentVisits))
+}
+
+func (e *Entry) addVisit(v *Visit) {
+	if v.Title != "" {
+		e.Title = v.Title
+	}
+	if v.FaviconHash != "" {
+		e.FaviconHash = v.FaviconHash
+	}
+	e.VisitCount++
+	if v.Time.After(e.LastVisit) {
+		e.LastVisit = v.Time
+	}
+	e.RecentVisits = append(e.RecentVisits, v.Time)
+	if len(e.RecentVisits) > maxRecentVisits {
+		e.RecentVisits = e.RecentVisits[len(e.RecentVisits)-maxRecentVisits:]
+	}
+}
+
+var (
+	// Keyed by time then sequence
+	visitsBucket = []byte("visits")
+	// Keyed by URL
+	entriesBucket = []byte("entries")
+	// Keyed by hash
+	faviconsBucket = []byte("favicons")
+)
+
+// Store persists history in a file. Entries are also kept in memory. It is
+// safe for concurrent use.
+type Store struct {
+	db *bolt.DB
+
+	entries     map[string]*Entry
+	entriesLock sync.RWMutex
+}
+
+// Open opens or creates the store at the given file path
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed opening history: %w", err)
+	}
+	s := &Store{db: db, entries: map[string]*Entry{}}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{visitsBucket, entriesBucket, faviconsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(entriesBucket).ForEach(func(k, v []byte) error {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("invalid entry for %s: %w", k, err)
+			}
+			s.entries[entry.URL] = &entry
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed loading history: %w", err)
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) AddVisit(v Visit) error {
+	s.entriesLock.Lock()
+	defer s.entriesLock.Unlock()
+	entry := Entry{URL: v.URL}
+	if existing := s.entries[v.URL]; existing != nil {
+		entry = *existing
+	}
+	// Visits without a favicon get the last known one
+	if v.FaviconHash == "" {
+		v.FaviconHash = entry.FaviconHash
+	}
+	entry.addVisit(&v)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		visits := tx.Bucket(visitsBucket)
+		seq, err := visits.NextSequence()
+		if err != nil {
+			return err
+		} else if err = putJSON(visits, visitKey(v.Time, seq), v); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(entriesBucket), []byte(v.URL), entry)
+	})
+	if err != nil {
+		return fmt.Errorf("failed adding visit: %w", err)
+	}
+	s.entries[v.URL] = &entry
+	return nil
+}
+
+// SetTitle updates the title of an existing entry and its latest visit, since
+// titles often arrive after the visit
+func (s *Store) SetTitle(url, title string) error {
+	return s.updateLatest(url, func(e *Entry, v *Visit) bool {
+		if title == "" || e.Title == title {
+			return false
+		}
+		e.Title, v.Title = title, title
+		return true
+	})
+}
+
+// SetFavicon stores the favicon and sets it on an existing entry and its
+// latest visit
+func (s *Store) SetFavicon(url string, favicon []byte) error {
+	if len(favicon) == 0 {
+		return nil
+	}
+	hashBytes := sha256.Sum256(favicon)
+	hash := hex.EncodeToString(hashBytes[:])
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(faviconsBucket).Put([]byte(hash), favicon)
+	})
+	if err != nil {
+		return fmt.Errorf("failed storing favicon: %w", err)
+	}
+	return s.updateLatest(url, func(e *Entry, v *Visit) bool {
+		if e.FaviconHash == hash {
+			return false
+		}
+		e.FaviconHash, v.FaviconHash = hash, hash
+		return true
+	})
+}
+
+// Calls update with copies of the entry and its latest visit, saving them if
+// it returns true. Does nothing if there is no entry.
+func (s *Store) updateLatest(url string, update func(*Entry, *Visit) bool) error {
+	s.entriesLock.Lock()
+	defer s.entriesLock.Unlock()
+	existing := s.entries[url]
+	if existing == nil {
+		return nil
+	}
+	entry := *existing
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		// Find the latest visit from the end
+		visits := tx.Bucket(visitsBucket)
+		c := visits.Cursor()
+		var visit Visit
+		var latestKey []byte
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if err := json.Unmarshal(v, &visit); err != nil {
+				return err
+			} else if visit.URL == url {
+				latestKey = k
+				break
+			}
+		}
+		if latestKey == nil || !update(&entry, &visit) {
+			return nil
+		} else if err := putJSON(visits, latestKey, visit); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(entriesBucket), []byte(url), entry)
+	})
+	if err != nil {
+		return fmt.Errorf("failed updating %v: %w", url, err)
+	}
+	s.entries[url] = &entry
+	return nil
+}
+
+// Favicon returns the favicon for the hash or nil if not found
+func (s *Store) Favicon(hash string) ([]byte, error) {
+	var favicon []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(faviconsBucket).Get([]byte(hash)); b != nil {
+			favicon = append([]byte(nil), b...)
+		}
+		return nil
+	})
+	return favicon, err
+}
+
+// Entries returns copies of every entry, most recently visited first
+func (s *Store) Entries() []Entry {
+	return s.filterEntries(func(*Entry) bool { return true })
+}
+
+// Recent returns up to limit visits, most recent first. A limit of 0 means no
+// limit.
+func (s *Store) Recent(limit int) ([]Visit, error) {
+	var visits []Visit
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(visitsBucket).Cursor()
+		for k, v := c.Last(); k != nil && (limit == 0 || len(visits) < limit); k, v = c.Prev() {
+			var visit Visit
+			if err := json.Unmarshal(v, &visit); err != nil {
+				return err
+			}
+			visits = append(visits, visit)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading visits: %w", err)
+	}
+	return visits, nil
+}
+
+// ByDomain returns entries whose host is the domain or a subdomain of it,
+// most recently visited first
+func (s *Store) ByDomain(domain string) []Entry {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	return s.filterEntries(func(e *Entry) bool {
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(u.Hostname())
+		return host == domain || strings.HasSuffix(host, "."+domain)
+	})
+}
+
+// Search returns entries whose URL or title contain the text case
+// insensitively, most recently visited first
+func (s *Store) Search(text string) []Entry {
+	text = strings.ToLower(text)
+	return s.filterEntries(func(e *Entry) bool {
+		return strings.Contains(strings.ToLower(e.URL), text) || strings.Contains(strings.ToLower(e.Title), text)
+	})
+}
+
+func (s *Store) filterEntries(include func(*Entry) bool) []Entry {
+	s.entriesLock.RLock()
+	var entries []Entry
+	for _, entry := range s.entries {
+		if include(entry) {
+			e := *entry
+			e.RecentVisits = append([]time.Time(nil), entry.RecentVisits...)
+			entries = append(entries, e)
+		}
+	}
+	s.entriesLock.RUnlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastVisit.After(entries[j].LastVisit) })
+	return entries
+}
+
+// Clear removes visits from the start time (inclusive) to the end time
+// (exclusive). A zero start or end is unbounded. Entries without remaining
+// visits are removed and the rest are recalculated. Favicons are kept.
+func (s *Store) Clear(start, end time.Time) error {
+	s.entriesLock.Lock()
+	defer s.entriesLock.Unlock()
+	newEntries := map[string]*Entry{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		visits := tx.Bucket(visitsBucket)
+		c := visits.Cursor()
+		var startKey, endKey []byte
+		if !start.IsZero() {
+			startKey = visitKey(start, 0)
+		}
+		if !end.IsZero() {
+			endKey = visitKey(end, 0)
+		}
+		// Collect the range first since deleting while iterating skips items
+		affected := map[string]bool{}
+		var keys [][]byte
+		k, v := c.First()
+		if startKey != nil {
+			k, v = c.Seek(startKey)
+		}
+		for ; k != nil && (endKey == nil || bytes.Compare(k, endKey) < 0); k, v = c.Next() {
+			var visit Visit
+			if err := json.Unmarshal(v, &visit); err != nil {
+				return err
+			}
+			affected[visit.URL] = true
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for _, k := range keys {
+			if err := visits.Delete(k); err != nil {
+				return err
+			}
+		}
+		if len(affected) == 0 {
+			return nil
+		}
+		// Rebuild the affected entries from the remaining visits
+		for url := range affected {
+			if old := s.entries[url]; old != nil {
+				newEntries[url] = &Entry{URL: url, Title: old.Title, FaviconHash: old.FaviconHash}
+			}
+		}
+		err := visits.ForEach(func(k, v []byte) error {
+			var visit Visit
+			if err := json.Unmarshal(v, &visit); err != nil {
+				return err
+			} else if entry := newEntries[visit.URL]; entry != nil {
+				entry.addVisit(&visit)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		entries := tx.Bucket(entriesBucket)
+		for url, entry := range newEntries {
+			if entry.VisitCount == 0 {
+				if err := entries.Delete([]byte(url)); err != nil {
+					return err
+				}
+			} else if err := putJSON(entries, []byte(url), entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed clearing history: %w", err)
+	}
+	for url, entry := range newEntries {
+		if entry.VisitCount == 0 {
+			delete(s.entries, url)
+		} else {
+			s.entries[url] = entry
+		}
+	}
+	return nil
+}
+
+// Big-endian so keys sort by time
+func visitKey(t time.Time, seq uint64) []byte {
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(k[8:], seq)
+	return k
+}
+
+func putJSON(b *bolt.Bucket, k []byte, v interface{}) error {
+	byts, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(k, byts)
+}
@@ -0,0 +1,271 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(dir, "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func addTestVisits(t *testing.T, s *Store, visits ...Visit) {
+	t.Helper()
+	for _, v := range visits {
+		if err := s.AddVisit(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func recentURLs(t *testing.T, s *Store) []string {
+	t.Helper()
+	visits, err := s.Recent(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, v := range visits {
+		urls = append(urls, v.URL)
+	}
+	return urls
+}
+
+func entryURLs(entries []Entry) []string {
+	var urls []string
+	for _, e := range entries {
+		urls = append(urls, e.URL)
+	}
+	return urls
+}
+
+func TestEntryFrecency(t *testing.T) {
+	now := time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days ...float64) []time.Time {
+		var times []time.Time
+		for _, d := range days {
+			times = append(times, now.Add(-time.Duration(d*24*float64(time.Hour))))
+		}
+		return times
+	}
+	tests := []struct {
+		name     string
+		entry    Entry
+		expected float64
+	}{
+		{"no visits", Entry{}, 0},
+		{"one recent", Entry{VisitCount: 1, RecentVisits: daysAgo(0)}, 100},
+		{"bucket edges", Entry{VisitCount: 5, RecentVisits: daysAgo(4, 14, 31, 90, 365)}, 5 * (70 + 50 + 30 + 10 + 10) / 5},
+		{"just inside buckets", Entry{VisitCount: 4, RecentVisits: daysAgo(3.9, 13.9, 30.9, 89.9)}, 4 * (100 + 70 + 50 + 30) / 4},
+		// Older visits count toward the total but only recent ones are weighed
+		{"scaled to count", Entry{VisitCount: 20, RecentVisits: daysAgo(1, 10)}, 20 * (100 + 70) / 2},
+	}
+	for _, test := range tests {
+		if frecency := test.entry.Frecency(now); frecency != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, frecency)
+		}
+	}
+}
+
+func TestAddVisit(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	start := time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < maxRecentVisits+2; i++ {
+		v := Visit{URL: "https://example.com/", Time: start.Add(time.Duration(i) * time.Minute)}
+		if i == 0 {
+			v.Title, v.FaviconHash = "Example", "hash1"
+		}
+		addTestVisits(t, s, v)
+	}
+	check := func(s *Store) {
+		t.Helper()
+		entries := s.Entries()
+		if len(entries) != 1 {
+			t.Fatalf("expected 1 entry, got %v", len(entries))
+		}
+		e := entries[0]
+		switch {
+		case e.Title != "Example" || e.FaviconHash != "hash1":
+			t.Fatalf("title and favicon not kept: %+v", e)
+		case e.VisitCount != maxRecentVisits+2 || !e.LastVisit.Equal(start.Add(11*time.Minute)):
+			t.Fatalf("unexpected count or last visit: %+v", e)
+		case len(e.RecentVisits) != maxRecentVisits || !e.RecentVisits[0].Equal(start.Add(2*time.Minute)):
+			t.Fatalf("unexpected recent visits %v", e.RecentVisits)
+		}
+		// The last known favicon is put on later visits
+		if visits, err := s.Recent(1); err != nil {
+			t.Fatal(err)
+		} else if len(visits) != 1 || visits[0].FaviconHash != "hash1" {
+			t.Fatalf("unexpected latest visit %+v", visits)
+		}
+	}
+	check(s)
+	s.Close()
+	check(openTestStore(t, dir))
+}
+
+func TestUpdateLatest(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	start := time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+	addTestVisits(t, s,
+		Visit{URL: "https://example.com/", Title: "First", Time: start},
+		Visit{URL: "https://example.com/", Time: start.Add(time.Minute)},
+		Visit{URL: "https://other.example/", Title: "Other", Time: start.Add(2 * time.Minute)},
+	)
+	if err := s.SetTitle("https://example.com/", "Second"); err != nil {
+		t.Fatal(err)
+	} else if err = s.SetFavicon("https://example.com/", []byte("icon")); err != nil {
+		t.Fatal(err)
+	}
+	// Unknown URLs and empty values are ignored
+	if err := s.SetTitle("https://unknown.example/", "Unknown"); err != nil {
+		t.Fatal(err)
+	} else if err = s.SetTitle("https://other.example/", ""); err != nil {
+		t.Fatal(err)
+	} else if err = s.SetFavicon("https://other.example/", nil); err != nil {
+		t.Fatal(err)
+	}
+	hashBytes := sha256.Sum256([]byte("icon"))
+	hash := hex.EncodeToString(hashBytes[:])
+	check := func(s *Store) {
+		t.Helper()
+		visits, err := s.Recent(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles, hashes []string
+		for _, v := range visits {
+			titles, hashes = append(titles, v.Title), append(hashes, v.FaviconHash)
+		}
+		// Only the latest visit of the URL changes
+		if !reflect.DeepEqual(titles, []string{"Other", "Second", "First"}) {
+			t.Fatalf("unexpected titles %v", titles)
+		} else if !reflect.DeepEqual(hashes, []string{"", hash, ""}) {
+			t.Fatalf("unexpected favicon hashes %v", hashes)
+		}
+		entries := s.Entries()
+		if len(entries) != 2 {
+			t.Fatalf("expected 2 entries, got %v", entryURLs(entries))
+		} else if e := entries[1]; e.Title != "Second" || e.FaviconHash != hash || e.VisitCount != 2 {
+			t.Fatalf("unexpected entry %+v", e)
+		} else if e = entries[0]; e.Title != "Other" || e.FaviconHash != "" {
+			t.Fatalf("unexpected entry %+v", e)
+		}
+		if favicon, err := s.Favicon(hash); err != nil {
+			t.Fatal(err)
+		} else if string(favicon) != "icon" {
+			t.Fatalf("unexpected favicon %q", favicon)
+		}
+	}
+	check(s)
+	s.Close()
+	check(openTestStore(t, dir))
+}
+
+func TestClear(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	start := time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	addTestVisits(t, s,
+		Visit{URL: "https://a.example/", Title: "A", Time: at(0)},
+		Visit{URL: "https://b.example/", Title: "B", Time: at(1)},
+		Visit{URL: "https://a.example/", Time: at(2)},
+		Visit{URL: "https://c.example/", Title: "C", Time: at(3)},
+		Visit{URL: "https://a.example/", Time: at(4)},
+		Visit{URL: "https://d.example/", Title: "D", Time: at(5)},
+	)
+	if err := s.SetFavicon("https://a.example/", []byte("icon")); err != nil {
+		t.Fatal(err)
+	}
+	// Start is inclusive, end exclusive
+	if err := s.Clear(at(1), at(4)); err != nil {
+		t.Fatal(err)
+	}
+	check := func(s *Store) {
+		t.Helper()
+		if urls := recentURLs(t, s); !reflect.DeepEqual(urls, []string{
+			"https://d.example/", "https://a.example/", "https://a.example/",
+		}) {
+			t.Fatalf("unexpected visits %v", urls)
+		}
+		entries := s.Entries()
+		if urls := entryURLs(entries); !reflect.DeepEqual(urls, []string{"https://d.example/", "https://a.example/"}) {
+			t.Fatalf("unexpected entries %v", urls)
+		}
+		// Rebuilt from what's left, keeping title and favicon
+		a := entries[1]
+		switch {
+		case a.Title != "A" || a.FaviconHash == "":
+			t.Fatalf("title and favicon not kept: %+v", a)
+		case a.VisitCount != 2 || !a.LastVisit.Equal(at(4)):
+			t.Fatalf("unexpected count or last visit: %+v", a)
+		case len(a.RecentVisits) != 2 || !a.RecentVisits[0].Equal(at(0)) || !a.RecentVisits[1].Equal(at(4)):
+			t.Fatalf("unexpected recent visits %v", a.RecentVisits)
+		}
+		if favicon, err := s.Favicon(a.FaviconHash); err != nil || string(favicon) != "icon" {
+			t.Fatalf("favicon not kept: %q %v", favicon, err)
+		}
+	}
+	check(s)
+	s.Close()
+	s = openTestStore(t, dir)
+	check(s)
+	// Clearing an empty range changes nothing
+	if err := s.Clear(at(10), at(20)); err != nil {
+		t.Fatal(err)
+	}
+	check(s)
+	// Unbounded start and end
+	if err := s.Clear(time.Time{}, at(5)); err != nil {
+		t.Fatal(err)
+	} else if urls := entryURLs(s.Entries()); !reflect.DeepEqual(urls, []string{"https://d.example/"}) {
+		t.Fatalf("unexpected entries %v", urls)
+	}
+	if err := s.Clear(time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	} else if len(s.Entries()) != 0 || len(recentURLs(t, s)) != 0 {
+		t.Fatal("expected everything cleared")
+	}
+}
+
+func TestByDomain(t *testing.T) {
+	s := openTestStore(t, t.TempDir())
+	start := time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+	urls := []string{
+		"https://example.com/",
+		"https://www.Example.com/a",
+		"http://a.b.example.com:8080/",
+		"https://badexample.com/",
+		"https://example.com.evil/",
+		"https://example.org/",
+		"not a url\x7f",
+	}
+	for i, u := range urls {
+		addTestVisits(t, s, Visit{URL: u, Time: start.Add(time.Duration(i) * time.Minute)})
+	}
+	expected := []string{"http://a.b.example.com:8080/", "https://www.Example.com/a", "https://example.com/"}
+	for _, domain := range []string{"example.com", "EXAMPLE.com", ".example.com"} {
+		if found := entryURLs(s.ByDomain(domain)); !reflect.DeepEqual(found, expected) {
+			t.Errorf("domain %v: expected %v, got %v", domain, expected, found)
+		}
+	}
+	if found := entryURLs(s.ByDomain("b.example.com")); !reflect.DeepEqual(found, expected[:1]) {
+		t.Errorf("expected only subdomain, got %v", found)
+	}
+	if found := s.ByDomain("missing.example"); len(found) != 0 {
+		t.Errorf("expected none, got %v", entryURLs(found))
+	}
+}
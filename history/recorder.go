@@ -0,0 +1,87 @@
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cretz/ffembedpoc/firefox"
+)
+
+// Record adds a visit to the store each time a navigation stops in a tab of
+// the given Firefox, including reloads, until the context is done. Titles and
+// favicons that arrive later are applied to the visit. Store errors are
+// logged.
+func Record(ctx context.Context, f *firefox.Firefox, s *Store, log firefox.Logger) {
+	r := &recorder{store: s, log: log, tabs: map[string]*tabRecorder{}}
+	f.TabListChangedListener.AddFunc(ctx, func() { r.updateTabs(ctx, f.Tabs()) })
+	r.updateTabs(ctx, f.Tabs())
+}
+
+type recorder struct {
+	store    *Store
+	log      firefox.Logger
+	tabs     map[string]*tabRecorder
+	tabsLock sync.Mutex
+}
+
+type tabRecorder struct {
+	*recorder
+	tab    *firefox.TabActor
+	cancel context.CancelFunc
+
+	// Only accessed on the listener goroutine
+	lastLoads int
+	lastTitle string
+}
+
+func (r *recorder) updateTabs(ctx context.Context, tabs []*firefox.TabActor) {
+	r.tabsLock.Lock()
+	defer r.tabsLock.Unlock()
+	seen := make(map[string]bool, len(tabs))
+	for _, tab := range tabs {
+		seen[tab.ID] = true
+		if r.tabs[tab.ID] != nil {
+			continue
+		}
+		tabCtx, cancel := context.WithCancel(ctx)
+		t := &tabRecorder{recorder: r, tab: tab, cancel: cancel}
+		r.tabs[tab.ID] = t
+		tab.StateChangedListener.AddFunc(tabCtx, t.onStateChanged)
+		tab.FaviconChangedListener.AddFunc(tabCtx, t.onFaviconChanged)
+	}
+	// Stop listening to closed tabs
+	for id, t := range r.tabs {
+		if !seen[id] {
+			t.cancel()
+			delete(r.tabs, id)
+		}
+	}
+}
+
+func (t *tabRecorder) onStateChanged() {
+	if t.tab.Navigating() {
+		return
+	}
+	url, title, loads := t.tab.URL(), t.tab.Title(), t.tab.Loads()
+	var err error
+	switch {
+	case url == "":
+	case loads != t.lastLoads:
+		err = t.store.AddVisit(Visit{URL: url, Title: title, Time: time.Now(), Transition: t.tab.LastTransition()})
+	case title != t.lastTitle:
+		err = t.store.SetTitle(url, title)
+	}
+	if err != nil {
+		t.log.Errorf("Failed recording history for %v: %v", url, err)
+	}
+	t.lastLoads, t.lastTitle = loads, title
+}
+
+func (t *tabRecorder) onFaviconChanged() {
+	if url := t.tab.URL(); url != "" {
+		if err := t.store.SetFavicon(url, t.tab.Favicon()); err != nil {
+			t.log.Errorf("Failed recording favicon for %v: %v", url, err)
+		}
+	}
+}
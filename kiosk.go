@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/cretz/ffembedpoc/firefox"
+	"github.com/therecipe/qt/widgets"
+)
+
+var (
+	kioskFlag          = flag.Bool("kiosk", false, "Run as a locked down single page kiosk")
+	kioskHomeFlag      = flag.String("kiosk-home", homeURL, "Kiosk home page, also where it goes on reset")
+	kioskIdleResetFlag = flag.Duration("kiosk-idle-reset", 2*time.Minute,
+		"Kiosk idle time before clearing browsing data and going home, 0 to never reset. Idle time is "+
+			"system wide, so input to any app on the machine keeps the kiosk from resetting.")
+)
+
+// Timeout for clearing and going home
+const kioskResetTimeout = 30 * time.Second
+
+// Shows only the page full screen, starting at home and resetting after being
+// idle until the context is done. Must be called on the main thread after
+// Firefox has begun.
+func startKiosk(ctx context.Context, f *firefox.Firefox, log firefox.Logger, window *widgets.QMainWindow) {
+	window.SetCentralWidget(f.Widget)
+	window.ShowFullScreen()
+	go func() {
+		// Start fresh in case the last run left anything behind
+		kioskReset(ctx, f, log)
+		if *kioskIdleResetFlag <= 0 {
+			return
+		}
+		// Idle time is system wide, which is what a terminal wants anyway
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		wasIdle := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			idle := firefox.IdleTime() >= *kioskIdleResetFlag
+			if idle && !wasIdle {
+				log.Infof("Idle for %v, resetting kiosk", *kioskIdleResetFlag)
+				kioskReset(ctx, f, log)
+			}
+			wasIdle = idle
+		}
+	}()
+}
+
+// Clears browsing data and replaces the tab with one at home so there is no
+// history to go back to
+func kioskReset(ctx context.Context, f *firefox.Firefox, log firefox.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, kioskResetTimeout)
+	defer cancel()
+	if err := f.ClearData(ctx, firefox.ClearBrowsingData); err != nil {
+		log.Errorf("Failed clearing kiosk data: %v", err)
+	}
+	if err := f.ResetTabs(ctx, *kioskHomeFlag); err != nil {
+		log.Errorf("Failed resetting kiosk tab: %v", err)
+	}
+	runOnMain(func() {
+		if err := f.FocusPage(); err != nil {
+			log.Errorf("Failed focusing kiosk page: %v", err)
+		}
+	})
+}
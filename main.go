@@ -2,13 +2,21 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/cretz/ffembedpoc/bookmarks"
+	"github.com/cretz/ffembedpoc/complete"
 	"github.com/cretz/ffembedpoc/firefox"
+	"github.com/cretz/ffembedpoc/history"
+	"github.com/cretz/ffembedpoc/session"
+	"github.com/cretz/ffembedpoc/urlfix"
 	"github.com/therecipe/qt/gui"
 	"github.com/therecipe/qt/widgets"
 	"go.uber.org/zap"
@@ -24,11 +32,18 @@ func main() {
 	}
 }
 
+// Time Firefox has to exit before it's killed
+const shutdownTimeout = 10 * time.Second
+
+// Firefox profile, our own databases are kept with it
+const profilePath = ".profile"
+
 var runOnMain func(func())
 
 func funcOnMain(f func()) func() { return func() { runOnMain(f) } }
 
 func run() error {
+	flag.Parse()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	// Create app and main helper
@@ -50,33 +65,91 @@ func run() error {
 	config := firefox.Config{
 		Log: log.Sugar(),
 		// LogRemoteMessages: true,
+		LogConsoleMessages: true,
+		StartupTimeout:     30 * time.Second,
+		DownloadDir:        downloadDir,
+		ProfilePath:        profilePath,
+		Kiosk:              *kioskFlag,
+		// Confine navigation if desired
+		// NavigationPolicy: &firefox.NavigationPolicy{
+		// 	Allow: []firefox.NavigationRule{{Host: "*.mozilla.org"}, {Scheme: "about"}},
+		// },
+	}
+	// Load the last session before anything can overwrite it. Kiosks don't
+	// keep sessions.
+	var prevSession *session.Session
+	if !*kioskFlag {
+		if prevSession, err = session.Load(sessionPath); err != nil {
+			return err
+		}
 	}
-	// Start firefox (TODO: timeout)
+	// Start firefox
 	ff, err := firefox.Start(ctx, config)
 	if err != nil {
 		return err
 	}
-	defer ff.Close()
-	// Create browser and start handlers
-	b := newBrowser(ff, config.Log)
-	if err := ff.Begin(); err != nil {
-		return err
-	}
+	defer func() {
+		// Let Firefox write its session and databases before killing it
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if method, err := ff.Shutdown(shutdownCtx); err != nil {
+			config.Log.Errorf("Failed shutting down Firefox: %v", err)
+		} else {
+			config.Log.Infof("Firefox shut down by %v", method)
+		}
+	}()
+
+	if *kioskFlag {
+		if err := ff.Begin(); err != nil {
+			return err
+		}
+		startKiosk(ctx, ff, config.Log, window)
+	} else {
+		// Open history
+		hist, err := history.Open(filepath.Join(profilePath, "history.db"))
+		if err != nil {
+			return err
+		}
+		defer hist.Close()
+		// Open bookmarks
+		marks, err := bookmarks.Open(filepath.Join(profilePath, "bookmarks.json"))
+		if err != nil {
+			return err
+		}
+		// Create browser and start handlers
+		b := newBrowser(ff, config.Log, window, hist, marks)
+		if err := ff.Begin(); err != nil {
+			return err
+		}
+		b.downloads.start(ctx)
+
+		// Central widget
+		layout := widgets.NewQGridLayout(nil)
+		layout.AddWidget2(b.tabWidget, 0, 0, 0)
+		layout.AddWidget2(b.bookmarks.bar, 1, 0, 0)
+		layout.AddWidget2(ff.Widget, 2, 0, 0)
+		layout.SetContentsMargins(0, 0, 0, 0)
+		layout.SetSpacing(0)
+		layout.SetRowStretch(0, 0)
+		layout.SetRowStretch(1, 0)
+		layout.SetRowStretch(2, 1)
+		frame := widgets.NewQFrame(nil, 0)
+		frame.SetLayout(layout)
+		window.SetCentralWidget(frame)
 
-	// Central widget
-	layout := widgets.NewQGridLayout(nil)
-	layout.AddWidget2(b.tabWidget, 0, 0, 0)
-	layout.AddWidget2(ff.Widget, 1, 0, 0)
-	layout.SetContentsMargins(0, 0, 0, 0)
-	layout.SetSpacing(0)
-	layout.SetRowStretch(0, 0)
-	layout.SetRowStretch(1, 1)
-	frame := widgets.NewQFrame(nil, 0)
-	frame.SetLayout(layout)
-	window.SetCentralWidget(frame)
-
-	// Show
-	window.Show()
+		// Show
+		window.Show()
+
+		// Restore the last session, saving it until close which must happen
+		// before Firefox is closed
+		sessions := session.NewManager(ff, sessionPath, config.Log)
+		defer func() {
+			if err := sessions.Close(); err != nil {
+				config.Log.Errorf("Failed saving session: %v", err)
+			}
+		}()
+		b.restoreSession(prevSession, sessions, window)
+	}
 
 	// Handle signals
 	go func() {
@@ -95,21 +168,39 @@ func run() error {
 }
 
 type browser struct {
-	firefox   *firefox.Firefox
-	log       firefox.Logger
-	tabWidget *widgets.QTabWidget
-	tabs      []*browserTab
-	tabsLock  sync.RWMutex
+	firefox     *firefox.Firefox
+	log         firefox.Logger
+	focus       *focusManager
+	bookmarks   *bookmarksUI
+	downloads   *downloadsPanel
+	console     *consolePanel
+	urlFixer    urlfix.Fixer
+	history     *history.Store
+	completions complete.Engine
+	tabWidget   *widgets.QTabWidget
+	tabs        []*browserTab
+	tabsLock    sync.RWMutex
 }
 
-func newBrowser(f *firefox.Firefox, log firefox.Logger) *browser {
-	b := &browser{firefox: f, log: log}
+func newBrowser(
+	f *firefox.Firefox,
+	log firefox.Logger,
+	window *widgets.QMainWindow,
+	hist *history.Store,
+	marks *bookmarks.Store,
+) *browser {
+	b := &browser{firefox: f, log: log, history: hist}
+	history.Record(context.Background(), f, b.history, log)
+	b.focus = newFocusManager(b, window)
+	b.bookmarks = newBookmarksUI(b, marks, window)
+	b.downloads = newDownloadsPanel(b, window)
+	b.console = newConsolePanel(b, window)
 	// Create the tab widget
 	b.tabWidget = widgets.NewQTabWidget(nil)
 	// Add widget handlers
 	b.tabWidget.ConnectCurrentChanged(func(int) {
 		// Do this async since it may happen inside of update where lock is held
-		go b.setSelectedFocus()
+		go runOnMain(b.focus.focusPage)
 	})
 	// Add listener for tab list changes
 	f.TabListChangedListener.AddFunc(context.Background(), funcOnMain(b.updateTabs))
@@ -125,14 +216,14 @@ func (b *browser) updateTabs() {
 			// New tab
 			bt := newBrowserTab(b, tab)
 			b.tabs = append(b.tabs, bt)
-			b.tabWidget.AddTab(bt.urlEditWidget, tab.Title())
+			b.tabWidget.AddTab(bt.toolbar.widget, tab.Title())
 			bt.updateStateUnlocked()
 		} else if b.tabs[i].tab.ID != tab.ID {
 			// If there is no existing tab, insert it
 			if existingIndex := b.indexOfUnlocked(tab.ID); existingIndex == -1 {
 				bt := newBrowserTab(b, tab)
 				b.tabs = append(b.tabs[:i], append([]*browserTab{bt}, b.tabs[i:]...)...)
-				b.tabWidget.InsertTab(i, bt.urlEditWidget, tab.Title())
+				b.tabWidget.InsertTab(i, bt.toolbar.widget, tab.Title())
 				bt.updateStateUnlocked()
 			} else {
 				// Move it
@@ -150,12 +241,14 @@ func (b *browser) updateTabs() {
 	}
 }
 
-func (b *browser) setSelectedFocus() {
+// Nil if there are no tabs
+func (b *browser) currentTab() *browserTab {
 	b.tabsLock.RLock()
 	defer b.tabsLock.RUnlock()
 	if index := b.tabWidget.CurrentIndex(); index >= 0 && index < len(b.tabs) {
-		b.tabs[index].tab.SetFocus()
+		return b.tabs[index]
 	}
+	return nil
 }
 
 func (b *browser) indexOfUnlocked(tabID string) int {
@@ -171,6 +264,8 @@ type browserTab struct {
 	*browser
 	tab           *firefox.TabActor
 	urlEditWidget *widgets.QLineEdit
+	toolbar       *navToolbar
+	completer     *urlCompleter
 }
 
 func newBrowserTab(b *browser, tab *firefox.TabActor) *browserTab {
@@ -180,13 +275,29 @@ func newBrowserTab(b *browser, tab *firefox.TabActor) *browserTab {
 
 	// Handle favicon change
 	tab.FaviconChangedListener.AddFunc(context.Background(), funcOnMain(bt.updateFavicon))
-	// Handle URL change
+	// Handle URL entry unless the completer is handling it
 	bt.urlEditWidget.ConnectReturnPressed(func() {
-		tab.NavigateTo(bt.urlEditWidget.Text())
+		if !bt.completer.choosing() {
+			bt.navigateToInput(bt.urlEditWidget.Text())
+		}
 	})
+	b.focus.addURLEdit(bt.urlEditWidget)
+	bt.toolbar = newNavToolbar(bt)
+	bt.completer = newURLCompleter(bt)
+	b.console.watch(tab)
 	return bt
 }
 
+// Navigates to the fixed up input, giving focus to the page after
+func (b *browserTab) navigateToInput(input string) {
+	url := b.urlFixer.Fix(input)
+	if url == "" {
+		return
+	}
+	b.tab.NavigateTo(url)
+	go runOnMain(b.focus.focusPage)
+}
+
 func (b *browserTab) updateState() {
 	b.tabsLock.RLock()
 	defer b.tabsLock.RUnlock()
@@ -202,25 +313,28 @@ func (b *browserTab) updateStateUnlocked() {
 		}
 	}
 	b.urlEditWidget.SetText(b.tab.URL())
+	b.toolbar.update()
 }
 
 func (b *browserTab) updateFavicon() {
-	var icon *gui.QIcon
-	if data := b.tab.Favicon(); len(data) == 0 {
-		icon = gui.NewQIcon()
-	} else {
-		pixmap := gui.NewQPixmap()
-		// TODO: This fails in cgo-less, ref https://github.com/therecipe/qt/issues/1193
-		if !pixmap.LoadFromData(data, uint(len(data)), "PNG", 0) {
-			b.log.Errorf("Failed loading favicon PNG")
-			icon = gui.NewQIcon()
-		} else {
-			icon = gui.NewQIcon2(pixmap)
-		}
-	}
+	icon := b.faviconIcon(b.tab.Favicon())
 	b.tabsLock.RLock()
 	defer b.tabsLock.RUnlock()
 	if index := b.indexOfUnlocked(b.tab.ID); index != -1 {
 		b.tabWidget.SetTabIcon(index, icon)
 	}
 }
+
+// Empty icon if no data or it fails to load
+func (b *browser) faviconIcon(data []byte) *gui.QIcon {
+	if len(data) == 0 {
+		return gui.NewQIcon()
+	}
+	pixmap := gui.NewQPixmap()
+	// TODO: This fails in cgo-less, ref https://github.com/therecipe/qt/issues/1193
+	if !pixmap.LoadFromData(data, uint(len(data)), "PNG", 0) {
+		b.log.Errorf("Failed loading favicon PNG")
+		return gui.NewQIcon()
+	}
+	return gui.NewQIcon2(pixmap)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/cretz/ffembedpoc/session"
+	"github.com/therecipe/qt/widgets"
+)
+
+const (
+	sessionPath           = "session.json"
+	sessionRestoreTimeout = 30 * time.Second
+)
+
+// Restores the previous session if there is one, asking first if the app
+// didn't exit cleanly, then starts saving. Must be called on the main thread
+// after Firefox has begun.
+func (b *browser) restoreSession(prev *session.Session, sessions *session.Manager, window *widgets.QMainWindow) {
+	if prev == nil || len(prev.Tabs) == 0 {
+		sessions.Start()
+		return
+	}
+	if !prev.Clean {
+		b.log.Infof("Previous session did not exit cleanly")
+		answer := widgets.QMessageBox_Question(window, "Restore Session",
+			"The browser did not close properly. Restore the previous tabs?",
+			widgets.QMessageBox__Yes|widgets.QMessageBox__No, widgets.QMessageBox__Yes)
+		if answer != widgets.QMessageBox__Yes {
+			sessions.Start()
+			return
+		}
+	}
+	// Don't save until restored so a partial restore doesn't replace the session
+	go func() {
+		defer sessions.Start()
+		ctx, cancel := context.WithTimeout(context.Background(), sessionRestoreTimeout)
+		defer cancel()
+		if err := session.Restore(ctx, b.firefox, prev); err != nil {
+			b.log.Errorf("Failed restoring session: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,244 @@
+// Package session saves the open tabs to a file as they change and restores
+// them, including after an unclean exit
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cretz/ffembedpoc/firefox"
+)
+
+// Session is a snapshot of the open tabs
+type Session struct {
+	Tabs []Tab `json:"tabs"`
+	// Index in Tabs, -1 if none
+	Selected int       `json:"selected"`
+	Saved    time.Time `json:"saved"`
+	// Only set when saved on close, so an unset value on load means the app
+	// didn't exit cleanly
+	Clean bool `json:"clean"`
+}
+
+type Tab struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+}
+
+// Load reads the session file, returning nil if it doesn't exist
+func Load(path string) (*Session, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed reading session: %w", err)
+	}
+	var s Session
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("invalid session file: %w", err)
+	}
+	return &s, nil
+}
+
+// Snapshot captures the current tabs of Firefox. Tabs without a URL are
+// skipped.
+func Snapshot(f *firefox.Firefox) *Session {
+	s := &Session{Selected: -1, Saved: time.Now()}
+	for _, tab := range f.Tabs() {
+		if tab.URL() == "" {
+			continue
+		}
+		if tab.Selected() {
+			s.Selected = len(s.Tabs)
+		}
+		s.Tabs = append(s.Tabs, Tab{URL: tab.URL(), Title: tab.Title()})
+	}
+	return s
+}
+
+// Restore opens the session's tabs in Firefox. The first existing tab is
+// navigated to the first URL and the rest are opened after it. This should be
+// called after RootActor.Begin.
+func Restore(ctx context.Context, f *firefox.Firefox, s *Session) error {
+	if len(s.Tabs) == 0 {
+		return nil
+	}
+	// Firefox always starts with a tab, wait for it to be listed
+	tabs := f.Tabs()
+	if len(tabs) == 0 {
+		ch := make(chan struct{}, 1)
+		f.TabListChangedListener.Add(ch)
+		defer f.TabListChangedListener.Remove(ch)
+		for tabs = f.Tabs(); len(tabs) == 0; tabs = f.Tabs() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ch:
+			}
+		}
+	}
+	tabs[0].NavigateTo(s.Tabs[0].URL)
+	for i := 1; i < len(s.Tabs); i++ {
+		if err := f.NewTab(ctx, s.Tabs[i].URL, false); err != nil {
+			return err
+		}
+	}
+	if s.Selected >= 0 && s.Selected < len(s.Tabs) {
+		return f.SelectTabIndex(ctx, s.Selected)
+	}
+	return nil
+}
+
+// Default for Manager.SaveDelay
+const DefaultSaveDelay = time.Second
+
+// Manager saves a session file as tabs change. It is not started until Start
+// is called.
+type Manager struct {
+	// Changes within this time of the first are saved together. Default is
+	// DefaultSaveDelay.
+	SaveDelay time.Duration
+
+	firefox *firefox.Firefox
+	path    string
+	log     firefox.Logger
+	dirtyCh chan struct{}
+
+	// Governs fields below it
+	lock   sync.Mutex
+	cancel context.CancelFunc
+	doneCh chan struct{}
+	// Per tab
+	tabCancels map[*firefox.TabActor]context.CancelFunc
+}
+
+func NewManager(f *firefox.Firefox, path string, log firefox.Logger) *Manager {
+	return &Manager{
+		firefox:    f,
+		path:       path,
+		log:        log,
+		dirtyCh:    make(chan struct{}, 1),
+		tabCancels: map[*firefox.TabActor]context.CancelFunc{},
+	}
+}
+
+// Start saves a snapshot each time the tab list or a tab changes until Close.
+// Saved snapshots are not marked clean.
+func (m *Manager) Start() {
+	m.lock.Lock()
+	if m.cancel != nil {
+		m.lock.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel, m.doneCh = cancel, make(chan struct{})
+	m.lock.Unlock()
+	m.firefox.TabListChangedListener.AddFunc(ctx, func() { m.updateTabs(ctx) })
+	m.updateTabs(ctx)
+	go m.run(ctx)
+}
+
+// Watches new tabs, stops watching closed ones, and marks dirty
+func (m *Manager) updateTabs(ctx context.Context) {
+	tabs := m.firefox.Tabs()
+	m.lock.Lock()
+	seen := make(map[*firefox.TabActor]bool, len(tabs))
+	for _, tab := range tabs {
+		seen[tab] = true
+		if m.tabCancels[tab] == nil {
+			tabCtx, cancel := context.WithCancel(ctx)
+			m.tabCancels[tab] = cancel
+			tab.StateChangedListener.AddFunc(tabCtx, m.markDirty)
+		}
+	}
+	for tab, cancel := range m.tabCancels {
+		if !seen[tab] {
+			cancel()
+			delete(m.tabCancels, tab)
+		}
+	}
+	m.lock.Unlock()
+	m.markDirty()
+}
+
+func (m *Manager) markDirty() {
+	select {
+	case m.dirtyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Manager) run(ctx context.Context) {
+	defer close(m.doneCh)
+	delay := m.SaveDelay
+	if delay == 0 {
+		delay = DefaultSaveDelay
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.dirtyCh:
+		}
+		// Let more changes come in
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if err := m.save(false); err != nil {
+			m.log.Errorf("Failed saving session: %v", err)
+		}
+	}
+}
+
+// Close stops watching and saves a final clean snapshot. This must be called
+// before Firefox is closed.
+func (m *Manager) Close() error {
+	m.lock.Lock()
+	cancel, doneCh := m.cancel, m.doneCh
+	m.cancel = nil
+	m.lock.Unlock()
+	if cancel != nil {
+		cancel()
+		<-doneCh
+	}
+	return m.save(true)
+}
+
+// Does nothing if there are no tabs, since Firefox always has one unless it
+// is gone
+func (m *Manager) save(clean bool) error {
+	s := Snapshot(m.firefox)
+	if len(s.Tabs) == 0 {
+		return nil
+	}
+	s.Clean = clean
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written to a temp file then renamed so a crash mid-write doesn't lose it
+	tmp, err := ioutil.TempFile(filepath.Dir(m.path), filepath.Base(m.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed creating temp file: %w", err)
+	}
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), m.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed writing session: %w", err)
+	}
+	return nil
+}
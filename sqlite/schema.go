@@ -0,0 +1,168 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+)
+
+type table struct {
+	name     string
+	rootPage uint32
+	columns  []string
+	// Keyed by lowercase name
+	columnIndexes map[string]int
+	// Integers in these are stored for integral reals
+	realColumns []bool
+	// The INTEGER PRIMARY KEY column which is the row ID, -1 if none
+	rowIDColumn  int
+	withoutRowID bool
+	// For WITHOUT ROWID tables, the column of each record value, primary key
+	// first
+	recordColumns []int
+}
+
+// The schema table, always at page 1
+var schemaTable = newTable("sqlite_schema", 1, []string{"type", "name", "tbl_name", "rootpage", "sql"})
+
+func newTable(name string, rootPage uint32, columns []string) *table {
+	t := &table{name: name, rootPage: rootPage, columns: columns, columnIndexes: map[string]int{},
+		realColumns: make([]bool, len(columns)), rowIDColumn: -1}
+	for i, column := range columns {
+		t.columnIndexes[strings.ToLower(column)] = i
+	}
+	return t
+}
+
+func (d *DB) readSchema() error {
+	d.tables = map[string]*table{}
+	return d.scan(schemaTable, func(row *Row) error {
+		// Virtual tables have no pages. Tables that can't be parsed are left
+		// out.
+		if row.Text("type") != "table" || row.Int("rootpage") <= 0 {
+			return nil
+		}
+		if t, err := parseCreateTable(row.Text("name"), uint32(row.Int("rootpage")), row.Text("sql")); err == nil {
+			d.tables[strings.ToLower(t.name)] = t
+		}
+		return nil
+	})
+}
+
+// Only the column names and primary key are taken from the statement
+func parseCreateTable(name string, rootPage uint32, sql string) (*table, error) {
+	open, close := strings.IndexByte(sql, '('), strings.LastIndexByte(sql, ')')
+	if open < 0 || close < open {
+		return nil, fmt.Errorf("unsupported definition of table %v", name)
+	}
+	var columns, columnTypes, primaryKey []string
+	for _, def := range splitTopLevel(sql[open+1 : close]) {
+		first, rest := firstName(def)
+		upper := strings.ToUpper(rest)
+		switch strings.ToUpper(first) {
+		case "":
+			continue
+		case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+			// Table constraint
+			if i := strings.Index(strings.ToUpper(def), "PRIMARY KEY"); i >= 0 {
+				keyOpen, keyClose := strings.IndexByte(def[i:], '('), strings.IndexByte(def[i:], ')')
+				if keyOpen < 0 || keyClose < keyOpen {
+					return nil, fmt.Errorf("unsupported primary key of table %v", name)
+				}
+				for _, key := range splitTopLevel(def[i+keyOpen+1 : i+keyClose]) {
+					// Without ASC, DESC, or COLLATE
+					keyName, _ := firstName(key)
+					primaryKey = append(primaryKey, keyName)
+				}
+			}
+			continue
+		}
+		columns = append(columns, first)
+		columnType := ""
+		if fields := strings.Fields(upper); len(fields) > 0 {
+			columnType = fields[0]
+		}
+		columnTypes = append(columnTypes, columnType)
+		if strings.Contains(upper, "PRIMARY KEY") {
+			primaryKey = []string{first}
+		}
+	}
+	t := newTable(name, rootPage, columns)
+	for i, columnType := range columnTypes {
+		t.realColumns[i] = !strings.Contains(columnType, "INT") && (strings.Contains(columnType, "REAL") ||
+			strings.Contains(columnType, "FLOA") || strings.Contains(columnType, "DOUB"))
+	}
+	t.withoutRowID = strings.Contains(strings.ToUpper(sql[close:]), "WITHOUT ROWID")
+	keyIndexes := make([]int, len(primaryKey))
+	for i, key := range primaryKey {
+		index, ok := t.columnIndexes[strings.ToLower(key)]
+		if !ok {
+			return nil, fmt.Errorf("unknown primary key column %v of table %v", key, name)
+		}
+		keyIndexes[i] = index
+	}
+	switch {
+	case t.withoutRowID && len(keyIndexes) == 0:
+		return nil, fmt.Errorf("no primary key for WITHOUT ROWID table %v", name)
+	case t.withoutRowID:
+		t.recordColumns = keyIndexes
+		for i := range columns {
+			isKey := false
+			for _, index := range keyIndexes {
+				isKey = isKey || index == i
+			}
+			if !isKey {
+				t.recordColumns = append(t.recordColumns, i)
+			}
+		}
+	case len(keyIndexes) == 1 && columnTypes[keyIndexes[0]] == "INTEGER":
+		t.rowIDColumn = keyIndexes[0]
+	}
+	return t, nil
+}
+
+// Splits at commas not in parentheses or quotes
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// The first identifier, unquoted, and what's after it
+func firstName(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", ""
+	}
+	closing := map[byte]byte{'"': '"', '`': '`', '[': ']', '\'': '\''}[s[0]]
+	if closing == 0 {
+		end := strings.IndexFunc(s, func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '(' })
+		if end < 0 {
+			return s, ""
+		}
+		return s[:end], s[end:]
+	}
+	if end := strings.IndexByte(s[1:], closing); end >= 0 {
+		return s[1 : end+1], s[end+2:]
+	}
+	return s[1:], ""
+}
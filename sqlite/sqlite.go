@@ -0,0 +1,436 @@
+// Package sqlite reads tables from SQLite database files without a driver.
+// Only whole table scans of UTF-8 databases are supported, which is enough to
+// import from Firefox profiles.
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+)
+
+// DB is a read-only snapshot of a database file and its write-ahead log
+type DB struct {
+	pageSize   int
+	usableSize int
+	pageCount  uint32
+	file       []byte
+	// Committed pages from the WAL, which replace the file's
+	walPages map[uint32][]byte
+	// Keyed by lowercase name
+	tables map[string]*table
+}
+
+const headerMagic = "SQLite format 3\x00"
+
+// Open reads the database file at the path and the committed pages of its WAL
+// file if there is one. The files are read once and never written or locked,
+// so the database can be in use. If another process writes while they are
+// read, the snapshot may be inconsistent.
+func Open(path string) (*DB, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading database: %w", err)
+	}
+	d := &DB{file: file}
+	if len(file) < 100 || string(file[:16]) != headerMagic {
+		return nil, fmt.Errorf("%v is not a SQLite database", path)
+	}
+	if d.pageSize = int(binary.BigEndian.Uint16(file[16:])); d.pageSize == 1 {
+		d.pageSize = 65536
+	}
+	if d.pageSize < 512 || d.pageSize&(d.pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size %v", d.pageSize)
+	} else if d.usableSize = d.pageSize - int(file[20]); d.usableSize < 480 {
+		return nil, fmt.Errorf("invalid usable page size %v", d.usableSize)
+	} else if enc := binary.BigEndian.Uint32(file[56:]); enc > 1 {
+		return nil, fmt.Errorf("unsupported text encoding %v", enc)
+	}
+	d.pageCount = uint32(len(file) / d.pageSize)
+	wal, err := ioutil.ReadFile(path + "-wal")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed reading WAL: %w", err)
+	} else if err := d.applyWAL(wal); err != nil {
+		return nil, err
+	} else if err := d.readSchema(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+)
+
+// Applies the WAL's frames up to the last valid commit, like a reader would
+func (d *DB) applyWAL(wal []byte) error {
+	// A WAL without a valid header has no frames to apply
+	if len(wal) < walHeaderSize {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch binary.BigEndian.Uint32(wal) {
+	case 0x377f0682:
+		order = binary.LittleEndian
+	case 0x377f0683:
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	if pageSize := binary.BigEndian.Uint32(wal[8:]); int(pageSize) != d.pageSize {
+		return fmt.Errorf("WAL page size %v doesn't match database page size %v", pageSize, d.pageSize)
+	}
+	s0, s1 := walChecksum(order, 0, 0, wal[:24])
+	if s0 != binary.BigEndian.Uint32(wal[24:]) || s1 != binary.BigEndian.Uint32(wal[28:]) {
+		return nil
+	}
+	salt := wal[16:24]
+	d.walPages = map[uint32][]byte{}
+	uncommitted := map[uint32][]byte{}
+	frameSize := walFrameHeaderSize + d.pageSize
+	for offset := walHeaderSize; offset+frameSize <= len(wal); offset += frameSize {
+		header, page := wal[offset:offset+walFrameHeaderSize], wal[offset+walFrameHeaderSize:offset+frameSize]
+		// Frames from before the last checkpoint or partially written ones
+		// end the log
+		if !bytes.Equal(header[8:16], salt) {
+			break
+		}
+		s0, s1 = walChecksum(order, s0, s1, header[:8])
+		s0, s1 = walChecksum(order, s0, s1, page)
+		if s0 != binary.BigEndian.Uint32(header[16:]) || s1 != binary.BigEndian.Uint32(header[20:]) {
+			break
+		}
+		uncommitted[binary.BigEndian.Uint32(header)] = page
+		// Non-zero database size marks a commit
+		if size := binary.BigEndian.Uint32(header[4:]); size > 0 {
+			for n, page := range uncommitted {
+				d.walPages[n] = page
+			}
+			uncommitted = map[uint32][]byte{}
+			d.pageCount = size
+		}
+	}
+	return nil
+}
+
+func walChecksum(order binary.ByteOrder, s0, s1 uint32, b []byte) (uint32, uint32) {
+	for i := 0; i+8 <= len(b); i += 8 {
+		s0 += order.Uint32(b[i:]) + s1
+		s1 += order.Uint32(b[i+4:]) + s0
+	}
+	return s0, s1
+}
+
+func (d *DB) page(n uint32) ([]byte, error) {
+	if n < 1 || n > d.pageCount {
+		return nil, fmt.Errorf("page %v out of range", n)
+	} else if page := d.walPages[n]; page != nil {
+		return page, nil
+	}
+	offset := int(n-1) * d.pageSize
+	if offset+d.pageSize > len(d.file) {
+		return nil, fmt.Errorf("page %v past end of file", n)
+	}
+	return d.file[offset : offset+d.pageSize], nil
+}
+
+// Row is a row of a table. Values are nil, int64, float64, string, or []byte.
+type Row struct {
+	table  *table
+	values []interface{}
+}
+
+// Value is the value of the column, nil if unknown. Names are case
+// insensitive. Columns added after the row was written are nil instead of
+// their default.
+func (r *Row) Value(column string) interface{} {
+	if i, ok := r.table.columnIndexes[strings.ToLower(column)]; ok {
+		return r.values[i]
+	}
+	return nil
+}
+
+// Int is the value of the column if it's an integer, otherwise 0
+func (r *Row) Int(column string) int64 {
+	v, _ := r.Value(column).(int64)
+	return v
+}
+
+// Text is the value of the column if it's text or a blob, otherwise empty
+func (r *Row) Text(column string) string {
+	switch v := r.Value(column).(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+// Blob is the value of the column if it's a blob or text, otherwise nil
+func (r *Row) Blob(column string) []byte {
+	switch v := r.Value(column).(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return nil
+}
+
+// Scan calls fn with every row of the table in the order stored, i.e. by row
+// ID or primary key, until fn returns an error
+func (d *DB) Scan(tableName string, fn func(*Row) error) error {
+	t := d.tables[strings.ToLower(tableName)]
+	if t == nil {
+		return fmt.Errorf("no table named %v", tableName)
+	}
+	return d.scan(t, fn)
+}
+
+// HasTable is true if the database has the table
+func (d *DB) HasTable(tableName string) bool {
+	return d.tables[strings.ToLower(tableName)] != nil
+}
+
+func (d *DB) scan(t *table, fn func(*Row) error) error {
+	err := d.walk(t.rootPage, 0, func(rowID int64, payload []byte) error {
+		values, err := decodeRecord(payload)
+		if err != nil {
+			return err
+		}
+		row := &Row{table: t, values: make([]interface{}, len(t.columns))}
+		if t.withoutRowID {
+			for i, v := range values {
+				if i < len(t.recordColumns) {
+					row.values[t.recordColumns[i]] = v
+				}
+			}
+		} else {
+			copy(row.values, values)
+			if t.rowIDColumn >= 0 {
+				row.values[t.rowIDColumn] = rowID
+			}
+		}
+		for i, v := range row.values {
+			if n, ok := v.(int64); ok && t.realColumns[i] {
+				row.values[i] = float64(n)
+			}
+		}
+		if err := fn(row); err != nil {
+			return &callbackError{err}
+		}
+		return nil
+	})
+	var callbackErr *callbackError
+	if errors.As(err, &callbackErr) {
+		return callbackErr.err
+	} else if err != nil {
+		return fmt.Errorf("failed reading table %v: %w", t.name, err)
+	}
+	return nil
+}
+
+// Wraps errors from scan callbacks so they're returned as is
+type callbackError struct{ err error }
+
+func (c *callbackError) Error() string { return c.err.Error() }
+
+// Deeper is corrupt, real trees are a handful of levels
+const maxTreeDepth = 64
+
+// B-tree page types
+const (
+	pageIndexInterior = 0x02
+	pageTableInterior = 0x05
+	pageIndexLeaf     = 0x0a
+	pageTableLeaf     = 0x0d
+)
+
+// Calls fn with the payload of every cell in the b-tree at the page in order,
+// and the row ID for table b-trees
+func (d *DB) walk(n uint32, depth int, fn func(rowID int64, payload []byte) error) error {
+	if depth > maxTreeDepth {
+		return fmt.Errorf("b-tree deeper than %v", maxTreeDepth)
+	}
+	page, err := d.page(n)
+	if err != nil {
+		return err
+	}
+	page = page[:d.usableSize]
+	header := 0
+	if n == 1 {
+		header = 100
+	}
+	typ := page[header]
+	cellCount := int(binary.BigEndian.Uint16(page[header+3:]))
+	pointers := header + 8
+	interior := typ == pageIndexInterior || typ == pageTableInterior
+	if interior {
+		pointers += 4
+	} else if typ != pageIndexLeaf && typ != pageTableLeaf {
+		return fmt.Errorf("page %v has invalid type %v", n, typ)
+	}
+	if pointers+2*cellCount > len(page) {
+		return fmt.Errorf("page %v has too many cells", n)
+	}
+	for i := 0; i < cellCount; i++ {
+		offset := int(binary.BigEndian.Uint16(page[pointers+2*i:]))
+		if offset < pointers || offset+4 > len(page) {
+			return fmt.Errorf("page %v has invalid cell offset %v", n, offset)
+		}
+		cell := page[offset:]
+		if interior {
+			if err := d.walk(binary.BigEndian.Uint32(cell), depth+1, fn); err != nil {
+				return err
+			}
+			// Interior table cells are only keys, but interior index cells
+			// are entries
+			if typ == pageTableInterior {
+				continue
+			}
+			cell = cell[4:]
+		}
+		size, sizeLen := readVarint(cell)
+		if sizeLen == 0 {
+			return fmt.Errorf("page %v has invalid cell", n)
+		}
+		cell = cell[sizeLen:]
+		var rowID uint64
+		if typ == pageTableLeaf {
+			var rowIDLen int
+			if rowID, rowIDLen = readVarint(cell); rowIDLen == 0 {
+				return fmt.Errorf("page %v has invalid cell", n)
+			}
+			cell = cell[rowIDLen:]
+		}
+		payload, err := d.payload(cell, size, typ == pageTableLeaf)
+		if err != nil {
+			return err
+		} else if err := fn(int64(rowID), payload); err != nil {
+			return err
+		}
+	}
+	if interior {
+		return d.walk(binary.BigEndian.Uint32(page[header+8:]), depth+1, fn)
+	}
+	return nil
+}
+
+// Reads the cell's payload of the given size, following overflow pages
+func (d *DB) payload(cell []byte, size uint64, tableLeaf bool) ([]byte, error) {
+	usable := uint64(d.usableSize)
+	maxLocal := usable - 35
+	if !tableLeaf {
+		maxLocal = (usable-12)*64/255 - 23
+	}
+	if size <= maxLocal {
+		if uint64(len(cell)) < size {
+			return nil, fmt.Errorf("cell payload past end of page")
+		}
+		return cell[:size], nil
+	}
+	if size > uint64(d.pageCount)*usable {
+		return nil, fmt.Errorf("cell payload size %v larger than database", size)
+	}
+	minLocal := (usable-12)*32/255 - 23
+	local := minLocal + (size-minLocal)%(usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	if uint64(len(cell)) < local+4 {
+		return nil, fmt.Errorf("cell payload past end of page")
+	}
+	payload := make([]byte, local, size)
+	copy(payload, cell)
+	next := binary.BigEndian.Uint32(cell[local:])
+	for uint64(len(payload)) < size {
+		page, err := d.page(next)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading overflow page: %w", err)
+		}
+		next = binary.BigEndian.Uint32(page)
+		n := size - uint64(len(payload))
+		if n > usable-4 {
+			n = usable - 4
+		}
+		payload = append(payload, page[4:4+n]...)
+	}
+	return payload, nil
+}
+
+// Length is 0 if the varint is truncated
+func readVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func decodeRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := readVarint(payload)
+	if n == 0 || headerSize < uint64(n) || headerSize > uint64(len(payload)) {
+		return nil, fmt.Errorf("invalid record header")
+	}
+	header, body := payload[n:headerSize], payload[headerSize:]
+	var values []interface{}
+	for len(header) > 0 {
+		serialType, n := readVarint(header)
+		if n == 0 {
+			return nil, fmt.Errorf("invalid record header")
+		}
+		header = header[n:]
+		var size uint64
+		switch {
+		case serialType <= 4:
+			size = serialType
+		case serialType == 5:
+			size = 6
+		case serialType == 6 || serialType == 7:
+			size = 8
+		case serialType == 10 || serialType == 11:
+			return nil, fmt.Errorf("invalid serial type %v", serialType)
+		case serialType >= 12:
+			size = (serialType - 12) / 2
+		}
+		if size > uint64(len(body)) {
+			return nil, fmt.Errorf("record value past end of payload")
+		}
+		value := body[:size]
+		body = body[size:]
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType <= 6:
+			var v int64
+			for _, b := range value {
+				v = v<<8 | int64(b)
+			}
+			// Sign extend
+			shift := 64 - 8*len(value)
+			values = append(values, v<<shift>>shift)
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(value)))
+		case serialType == 8 || serialType == 9:
+			values = append(values, int64(serialType-8))
+		case serialType%2 == 0:
+			values = append(values, append([]byte(nil), value...))
+		default:
+			values = append(values, string(value))
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,193 @@
+package sqlite
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// See testdata/test.sql for how the database was made
+
+func TestScanWithWAL(t *testing.T) {
+	db, err := Open("testdata/test.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := scanItems(t, db)
+	// Committed WAL changes are applied, uncommitted ones aren't
+	if len(rows) != 600 {
+		t.Fatalf("expected 600 items, got %v", len(rows))
+	} else if rows[2].Text("name") != "updated" {
+		t.Fatalf("expected updated name, got %v", rows[2].Text("name"))
+	} else if rows[3] != nil {
+		t.Fatal("expected deleted item")
+	} else if rows[1001].Text("name") != "wal item" {
+		t.Fatalf("expected WAL item, got %v", rows[1001].Text("name"))
+	}
+	for id := range rows {
+		if id > 2000 {
+			t.Fatalf("uncommitted item %v read", id)
+		}
+	}
+	var walOnly []string
+	err = db.Scan("wal_only", func(row *Row) error {
+		walOnly = append(walOnly, row.Text("name"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(walOnly) != 1 || walOnly[0] != "wal only" {
+		t.Fatalf("unexpected WAL only rows %v", walOnly)
+	}
+}
+
+func TestScanWithoutWAL(t *testing.T) {
+	// Only the database file, as if the WAL was checkpointed away
+	dir, err := ioutil.TempDir("", "sqlite-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	b, err := ioutil.ReadFile("testdata/test.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	} else if err = ioutil.WriteFile(filepath.Join(dir, "test.sqlite"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(filepath.Join(dir, "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := scanItems(t, db)
+	if len(rows) != 600 {
+		t.Fatalf("expected 600 items, got %v", len(rows))
+	} else if rows[2].Text("name") != "item 2" || rows[3] == nil || rows[1001] != nil {
+		t.Fatal("WAL changes applied without WAL")
+	} else if db.HasTable("wal_only") {
+		t.Fatal("WAL table exists without WAL")
+	}
+}
+
+// Checks every item against how it was generated, keyed by ID
+func scanItems(t *testing.T, db *DB) map[int64]*Row {
+	rows := map[int64]*Row{}
+	lastID := int64(0)
+	err := db.Scan("items", func(row *Row) error {
+		id := row.Int("id")
+		if id <= lastID {
+			t.Fatalf("item %v after %v", id, lastID)
+		}
+		lastID = id
+		rows[id] = row
+		// Only check the generated ones
+		if id > 600 || id == 2 {
+			return nil
+		}
+		expectedN := (id - 250) * 1000003
+		if id == 1 {
+			expectedN = -9223372036854775808
+		}
+		var expectedData []byte
+		if id%50 == 0 && id <= 500 {
+			expectedData = []byte(strings.Repeat("ab"+strconv.Itoa(int(id)), 3000+int(id)))
+		}
+		switch {
+		case row.Text("name") != "item "+strconv.Itoa(int(id)):
+			t.Fatalf("item %v has name %v", id, row.Text("name"))
+		case id <= 500 && row.Int("n") != expectedN:
+			t.Fatalf("item %v has n %v", id, row.Int("n"))
+		case id <= 500 && row.Value("score") != float64(id)*1.5:
+			t.Fatalf("item %v has score %v", id, row.Value("score"))
+		case string(row.Blob("data")) != string(expectedData):
+			t.Fatalf("item %v has data of length %v", id, len(row.Blob("data")))
+		case id <= 500 && row.Value("extra") != nil:
+			t.Fatalf("item %v has extra %v", id, row.Value("extra"))
+		case id > 500 && row.Text("EXTRA") != "extra "+strconv.Itoa(int(id)):
+			t.Fatalf("item %v has extra %v", id, row.Value("extra"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestScanWithoutRowID(t *testing.T) {
+	db, err := Open("testdata/test.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	var lastB, lastA int64 = -1, 0
+	err = db.Scan("links", func(row *Row) error {
+		count++
+		a, b := row.Int("a"), row.Int("b")
+		// Stored by primary key (b, a)
+		if b < lastB || (b == lastB && a <= lastA) {
+			t.Fatalf("link (%v, %v) after (%v, %v)", b, a, lastB, lastA)
+		}
+		lastB, lastA = b, a
+		expectedNoteLen := 40
+		if a%40 == 0 {
+			expectedNoteLen = 500
+		}
+		if b != a%7 {
+			t.Fatalf("link %v has b %v", a, b)
+		} else if row.Text("note") != strings.Repeat("n", expectedNoteLen) {
+			t.Fatalf("link %v has note of length %v", a, len(row.Text("note")))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if count != 400 {
+		t.Fatalf("expected 400 links, got %v", count)
+	}
+}
+
+func TestScanQuotedNames(t *testing.T) {
+	db, err := Open("testdata/test.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []*Row
+	err = db.Scan("Quoted Table", func(row *Row) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %v", len(rows))
+	} else if r := rows[0]; r.Text("first col") != "one" || r.Int("second") != 2 || r.Text("third") != "three" {
+		t.Fatalf("unexpected row %v", r.values)
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	db, err := Open("testdata/test.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Callback errors are returned as is
+	stop := errors.New("stop")
+	count := 0
+	err = db.Scan("items", func(*Row) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Fatalf("expected stop after 1 row, got %v after %v", err, count)
+	}
+	if err = db.Scan("missing", func(*Row) error { return nil }); err == nil {
+		t.Fatal("expected error for missing table")
+	}
+	if _, err = Open("testdata/test.sql"); err == nil {
+		t.Fatal("expected error for non-database")
+	}
+}
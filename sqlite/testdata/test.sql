@@ -0,0 +1,47 @@
+-- Generates test.sqlite and test.sqlite-wal, run from this dir with:
+--   rm -f test.sqlite*; sqlite3 gen.sqlite < test.sql; rm -f gen.sqlite*
+-- The copies are taken mid-transaction so the WAL has committed frames
+-- followed by uncommitted ones.
+PRAGMA page_size = 1024;
+
+-- Enough rows for interior pages, some with overflow pages
+CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL, n INTEGER, score REAL, data BLOB);
+WITH RECURSIVE seq(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM seq WHERE i < 500)
+INSERT INTO items SELECT
+  i,
+  'item ' || i,
+  CASE WHEN i = 1 THEN -9223372036854775808 ELSE (i - 250) * 1000003 END,
+  i * 1.5,
+  CASE WHEN i % 50 = 0 THEN CAST(replace(printf('%.*c', 3000 + i, 'x'), 'x', 'ab' || i) AS BLOB) END
+FROM seq;
+
+-- Rows from before this have no value for it
+ALTER TABLE items ADD COLUMN extra TEXT DEFAULT 'default';
+WITH RECURSIVE seq(i) AS (SELECT 501 UNION ALL SELECT i + 1 FROM seq WHERE i < 600)
+INSERT INTO items (id, name, extra) SELECT i, 'item ' || i, 'extra ' || i FROM seq;
+
+-- Records are stored in primary key order, with interior cells holding
+-- entries and some overflowing
+CREATE TABLE links (a INTEGER NOT NULL, b INTEGER NOT NULL, note TEXT, PRIMARY KEY (b, a)) WITHOUT ROWID;
+WITH RECURSIVE seq(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM seq WHERE i < 400)
+INSERT INTO links SELECT i, i % 7, printf('%.*c', CASE WHEN i % 40 = 0 THEN 500 ELSE 40 END, 'n') FROM seq;
+
+CREATE TABLE [quoted table] ("first col" TEXT, `second` INTEGER, 'third' TEXT);
+INSERT INTO [quoted table] VALUES ('one', 2, 'three');
+
+PRAGMA journal_mode = WAL;
+PRAGMA wal_autocheckpoint = 0;
+INSERT INTO items (id, name) VALUES (1001, 'wal item');
+UPDATE items SET name = 'updated' WHERE id = 2;
+DELETE FROM items WHERE id = 3;
+CREATE TABLE wal_only (id INTEGER PRIMARY KEY, name TEXT);
+INSERT INTO wal_only VALUES (1, 'wal only');
+
+-- Spills uncommitted pages to the WAL
+PRAGMA cache_size = 2;
+BEGIN;
+WITH RECURSIVE seq(i) AS (SELECT 2001 UNION ALL SELECT i + 1 FROM seq WHERE i < 2030)
+INSERT INTO items (id, name, data) SELECT i, 'uncommitted ' || i, zeroblob(2000) FROM seq;
+DELETE FROM wal_only;
+.shell cp gen.sqlite test.sqlite && cp gen.sqlite-wal test.sqlite-wal
+ROLLBACK;
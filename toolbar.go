@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+const homeURL = "about:home"
+
+// Timeout for each navigation request
+const navTimeout = 10 * time.Second
+
+// Navigation buttons, the URL edit, and a loading indicator for a tab. Methods
+// must be called on the main thread.
+type navToolbar struct {
+	*browserTab
+	widget         *widgets.QToolBar
+	back           *widgets.QAction
+	forward        *widgets.QAction
+	reloadStop     *widgets.QAction
+	star           *widgets.QAction
+	progressAction *widgets.QAction
+	reloadIcon     *gui.QIcon
+	stopIcon       *gui.QIcon
+}
+
+func newNavToolbar(bt *browserTab) *navToolbar {
+	t := &navToolbar{browserTab: bt, widget: widgets.NewQToolBar2(nil)}
+	style := t.widget.Style()
+	icon := func(p widgets.QStyle__StandardPixmap) *gui.QIcon { return style.StandardIcon(p, nil, nil) }
+	t.reloadIcon, t.stopIcon = icon(widgets.QStyle__SP_BrowserReload), icon(widgets.QStyle__SP_BrowserStop)
+	t.back = t.widget.AddAction2(icon(widgets.QStyle__SP_ArrowBack), "Back")
+	t.back.ConnectTriggered(func(bool) { t.navigate("going back", bt.tab.GoBack) })
+	t.forward = t.widget.AddAction2(icon(widgets.QStyle__SP_ArrowForward), "Forward")
+	t.forward.ConnectTriggered(func(bool) { t.navigate("going forward", bt.tab.GoForward) })
+	t.reloadStop = t.widget.AddAction2(t.reloadIcon, "Reload")
+	t.reloadStop.ConnectTriggered(func(bool) {
+		// Decide at click time since the state may have changed since update
+		if bt.tab.Navigating() {
+			t.navigate("stopping", bt.tab.Stop)
+		} else {
+			t.navigate("reloading", func(ctx context.Context) error { return bt.tab.Reload(ctx, false) })
+		}
+	})
+	home := t.widget.AddAction2(icon(widgets.QStyle__SP_DirHomeIcon), "Home")
+	home.ConnectTriggered(func(bool) {
+		bt.tab.NavigateTo(homeURL)
+		go runOnMain(bt.focus.focusPage)
+	})
+	t.widget.AddWidget(bt.urlEditWidget)
+	t.star = t.widget.AddAction("☆")
+	t.star.SetCheckable(true)
+	t.star.SetToolTip("Bookmark this page")
+	t.star.ConnectTriggered(func(bool) { bt.bookmarks.toggle(bt.tab) })
+	// Busy indicator since Firefox doesn't report load progress
+	progress := widgets.NewQProgressBar(nil)
+	progress.SetRange(0, 0)
+	progress.SetTextVisible(false)
+	progress.SetMaximumWidth(60)
+	t.progressAction = t.widget.AddWidget(progress)
+	return t
+}
+
+// Runs the navigation off the main thread, logging failure
+func (t *navToolbar) navigate(desc string, fn func(context.Context) error) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), navTimeout)
+		defer cancel()
+		if err := fn(ctx); err != nil {
+			t.log.Errorf("Failed %v: %v", desc, err)
+		}
+	}()
+}
+
+func (t *navToolbar) update() {
+	t.back.SetEnabled(t.tab.CanGoBack())
+	t.forward.SetEnabled(t.tab.CanGoForward())
+	navigating := t.tab.Navigating()
+	if navigating {
+		t.reloadStop.SetIcon(t.stopIcon)
+		t.reloadStop.SetText("Stop")
+	} else {
+		t.reloadStop.SetIcon(t.reloadIcon)
+		t.reloadStop.SetText("Reload")
+	}
+	t.progressAction.SetVisible(navigating)
+	bookmarked := t.bookmarks.bookmarked(t.tab)
+	t.star.SetChecked(bookmarked)
+	if bookmarked {
+		t.star.SetText("★")
+	} else {
+		t.star.SetText("☆")
+	}
+}
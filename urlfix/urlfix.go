@@ -0,0 +1,139 @@
+// Package urlfix turns address bar input into a URL to navigate to, adding
+// missing schemes and falling back to a search.
+package urlfix
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultSearchTemplate is used when Fixer.SearchTemplate is empty
+const DefaultSearchTemplate = "https://duckduckgo.com/?q={searchTerms}"
+
+// Fixer fixes up address bar input. The zero value is usable.
+type Fixer struct {
+	// URL with {searchTerms} replaced by the escaped input for anything that
+	// isn't a URL. Default is DefaultSearchTemplate.
+	SearchTemplate string
+}
+
+// Fix uses a zero Fixer
+func Fix(input string) string {
+	var f Fixer
+	return f.Fix(input)
+}
+
+// Schemes that don't use "//" but are still kept as is
+var knownOpaqueSchemes = map[string]bool{
+	"about":       true,
+	"data":        true,
+	"javascript":  true,
+	"mailto":      true,
+	"view-source": true,
+	"blob":        true,
+}
+
+var (
+	schemeWithSlashes = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://`)
+	windowsDrivePath  = regexp.MustCompile(`^[a-zA-Z]:[\\/]`)
+	hostLabel         = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+	tld               = regexp.MustCompile(`^(?i)([a-z]{2,}|xn--[a-z0-9-]+)$`)
+)
+
+// Fix returns the URL for the input. Empty input returns an empty string. A
+// leading "?" forces a search.
+func (f *Fixer) Fix(input string) string {
+	input = strings.TrimSpace(input)
+	switch {
+	case input == "":
+		return ""
+	case strings.HasPrefix(input, "?"):
+		return f.search(strings.TrimSpace(input[1:]))
+	case schemeWithSlashes.MatchString(input):
+		return input
+	case windowsDrivePath.MatchString(input):
+		return fileURL("", "/"+strings.ReplaceAll(input, `\`, "/"))
+	case strings.HasPrefix(input, `\\`):
+		// UNC path, the first part is the host
+		hostAndPath := strings.ReplaceAll(input[2:], `\`, "/")
+		if i := strings.Index(hostAndPath, "/"); i > 0 {
+			return fileURL(hostAndPath[:i], hostAndPath[i:])
+		}
+		return fileURL(hostAndPath, "/")
+	case strings.HasPrefix(input, "/"):
+		return fileURL("", input)
+	case strings.ContainsAny(input, " \t"):
+		return f.search(input)
+	}
+	if i := strings.Index(input, ":"); i > 0 && knownOpaqueSchemes[strings.ToLower(input[:i])] {
+		return input
+	}
+	// Bare IPv6
+	if ip := net.ParseIP(input); ip != nil && ip.To4() == nil {
+		return "http://[" + input + "]/"
+	}
+	if scheme := hostScheme(input); scheme != "" {
+		return scheme + "://" + input
+	}
+	return f.search(input)
+}
+
+// Escapes the path, e.g. spaces and "#"
+func fileURL(host, path string) string {
+	return (&url.URL{Scheme: "file", Host: host, Path: path}).String()
+}
+
+func (f *Fixer) search(terms string) string {
+	template := f.SearchTemplate
+	if template == "" {
+		template = DefaultSearchTemplate
+	}
+	return strings.ReplaceAll(template, "{searchTerms}", url.QueryEscape(terms))
+}
+
+// Returns the scheme to use if the input starts with a host (and optional
+// port), or empty if it doesn't. Local hosts and IPs get http, others https.
+func hostScheme(input string) string {
+	u, err := url.Parse("http://" + input)
+	if err != nil || u.User != nil || u.Host == "" {
+		return ""
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return ""
+		}
+	} else if strings.HasSuffix(u.Host, ":") {
+		return ""
+	}
+	host := u.Hostname()
+	switch {
+	case strings.EqualFold(host, "localhost"):
+		return "http"
+	case net.ParseIP(host) != nil:
+		// Don't treat plain numbers as hosts, only dotted IPv4 or IPv6
+		if strings.Count(host, ".") == 3 || strings.Contains(host, ":") {
+			return "http"
+		}
+		return ""
+	}
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	for _, label := range labels {
+		if !hostLabel.MatchString(label) {
+			return ""
+		}
+	}
+	// A single label is only a host with a port (e.g. an intranet machine)
+	if len(labels) == 1 {
+		if u.Port() != "" {
+			return "http"
+		}
+		return ""
+	}
+	if !tld.MatchString(labels[len(labels)-1]) {
+		return ""
+	}
+	return "https"
+}
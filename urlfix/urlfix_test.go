@@ -0,0 +1,56 @@
+package urlfix
+
+import "testing"
+
+func TestFix(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Schemes are left alone
+		{"http://example.com/a", "http://example.com/a"},
+		{"ftp://files.example.com", "ftp://files.example.com"},
+		{"about:config", "about:config"},
+		{"mailto:a@example.com", "mailto:a@example.com"},
+		{"view-source:https://example.com", "view-source:https://example.com"},
+		{"file:///C:/x", "file:///C:/x"},
+		// Drive, UNC, and absolute paths
+		{`C:\Users\me\a.html`, "file:///C:/Users/me/a.html"},
+		{"c:/Users/me/a.html", "file:///c:/Users/me/a.html"},
+		{`C:\Program Files\Mozilla Firefox\readme.txt`, "file:///C:/Program%20Files/Mozilla%20Firefox/readme.txt"},
+		{`C:\docs\a#b.html`, "file:///C:/docs/a%23b.html"},
+		{`\\server\share\a.pdf`, "file://server/share/a.pdf"},
+		{`\\server\share\My Docs\a.pdf`, "file://server/share/My%20Docs/a.pdf"},
+		{`\\server`, "file://server/"},
+		{"/home/me/my file.html", "file:///home/me/my%20file.html"},
+		// IP addresses
+		{"::1", "http://[::1]/"},
+		{"[::1]:8080", "http://[::1]:8080"},
+		{"2001:db8::1", "http://[2001:db8::1]/"},
+		{"192.168.1.1", "http://192.168.1.1"},
+		{"192.168.1.1:3000", "http://192.168.1.1:3000"},
+		// Local hosts with ports
+		{"localhost", "http://localhost"},
+		{"localhost:3000", "http://localhost:3000"},
+		{"intranet:8080", "http://intranet:8080"},
+		// Bare hosts
+		{"example.com", "https://example.com"},
+		{"example.com/a?b=c", "https://example.com/a?b=c"},
+		{"my-host.local", "https://my-host.local"},
+		// Search terms
+		{"foo", "https://duckduckgo.com/?q=foo"},
+		{"1234", "https://duckduckgo.com/?q=1234"},
+		{"foo.123", "https://duckduckgo.com/?q=foo.123"},
+		{"-bad.com", "https://duckduckgo.com/?q=-bad.com"},
+		{"example.com:99999", "https://duckduckgo.com/?q=example.com%3A99999"},
+		{"?example.com", "https://duckduckgo.com/?q=example.com"},
+		{"hello world", "https://duckduckgo.com/?q=hello+world"},
+		{"what is go?", "https://duckduckgo.com/?q=what+is+go%3F"},
+		{"  ", ""},
+	}
+	for _, test := range tests {
+		if actual := Fix(test.input); actual != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, actual)
+		}
+	}
+}